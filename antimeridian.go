@@ -0,0 +1,114 @@
+package spatial
+
+import (
+	"github.com/dhconnelly/rtreego"
+	"github.com/viert/spatial/internal/rtreeutil"
+)
+
+// fragment is a part of an object crossing the antimeridian. Such objects
+// are indexed as a number of fragments which are unwrapped back into
+// the object by searches
+type fragment struct {
+	Indexable
+	bounds *rtreego.Rect
+}
+
+// Bounds implements Indexable
+func (f *fragment) Bounds() *rtreego.Rect {
+	return f.bounds
+}
+
+// unwrap returns the object a fragment belongs to, other objects are returned as is
+func unwrap(sp rtreego.Spatial) rtreego.Spatial {
+	if f, ok := sp.(*fragment); ok {
+		return f.Indexable
+	}
+	return sp
+}
+
+// unwrapFilters makes filters see objects instead of their fragments
+func unwrapFilters(filters []rtreego.Filter) []rtreego.Filter {
+	wrapped := make([]rtreego.Filter, len(filters))
+	for i, filter := range filters {
+		filter := filter
+		wrapped[i] = func(results []rtreego.Spatial, obj rtreego.Spatial) (bool, bool) {
+			return filter(results, unwrap(obj))
+		}
+	}
+	return wrapped
+}
+
+// splitRect brings a rect going beyond the antimeridian into [-180, 180]
+// longitudes splitting it if needed, rects within the range are returned as is
+func splitRect(r *rtreego.Rect) []*rtreego.Rect {
+	lo, size := r.PointCoord(1), r.LengthsCoord(1)
+	if lo >= -180 && lo+size <= 180 {
+		return []*rtreego.Rect{r}
+	}
+
+	lat, latSize := r.PointCoord(0), r.LengthsCoord(0)
+	if size >= 360 {
+		world, _ := rtreego.NewRect(rtreego.Point{lat, -180}, []float64{latSize, 360})
+		return []*rtreego.Rect{world}
+	}
+
+	lo = wrapLongitude(lo)
+	hi := lo + size
+	if hi <= 180 {
+		// the rect lies beyond the range entirely
+		wrapped, _ := rtreego.NewRect(rtreego.Point{lat, lo}, []float64{latSize, size})
+		return []*rtreego.Rect{wrapped}
+	}
+	west, _ := rtreego.NewRect(rtreego.Point{lat, lo}, []float64{latSize, 180 - lo})
+	east, _ := rtreego.NewRect(rtreego.Point{lat, -180}, []float64{latSize, hi - 360 + 180})
+	return []*rtreego.Rect{west, east}
+}
+
+// intersectsWrapped checks if rects intersect taking the antimeridian into account
+func intersectsWrapped(a *rtreego.Rect, b *rtreego.Rect) bool {
+	for _, ra := range splitRect(a) {
+		for _, rb := range splitRect(b) {
+			if rtreeutil.Intersects(ra, rb) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// makeEntries returns what obj is to be indexed as
+// and remembers fragments if it's split
+func (s *Server) makeEntries(obj Indexable) []rtreego.Spatial {
+	rects := splitRect(obj.Bounds())
+	if len(rects) == 1 && rects[0] == obj.Bounds() {
+		return []rtreego.Spatial{obj}
+	}
+
+	entries := make([]rtreego.Spatial, len(rects))
+	for i, rect := range rects {
+		entries[i] = &fragment{Indexable: obj, bounds: rect}
+	}
+	s.lock.Lock()
+	s.fragments[obj.ID()] = entries
+	s.lock.Unlock()
+	return entries
+}
+
+// takeEntries returns what an indexed object is indexed as
+// and forgets its fragments. The object's id lock must be held
+func (s *Server) takeEntries(obj Indexable) []rtreego.Spatial {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if entries, found := s.fragments[obj.ID()]; found {
+		delete(s.fragments, obj.ID())
+		return entries
+	}
+	return []rtreego.Spatial{obj}
+}
+
+// hasFragments checks if any object is split
+func (s *Server) hasFragments() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.fragments) > 0
+}
@@ -0,0 +1,216 @@
+package spatial
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dhconnelly/rtreego"
+)
+
+// AttrKind is a type of value an Attr holds
+type AttrKind int
+
+// Attr kinds
+const (
+	AttrInt AttrKind = iota + 1
+	AttrFloat
+	AttrBool
+	AttrString
+	AttrTime
+)
+
+var (
+	attrKindNames = map[AttrKind]string{
+		AttrInt:    "int",
+		AttrFloat:  "float",
+		AttrBool:   "bool",
+		AttrString: "string",
+		AttrTime:   "time",
+	}
+)
+
+// Attr is a typed attribute value, the zero Attr holds no value
+type Attr struct {
+	kind AttrKind
+	i    int64
+	f    float64
+	s    string
+	t    time.Time
+}
+
+// Attributed is implemented by objects having typed attributes
+type Attributed interface {
+	Attr(key string) (Attr, bool)
+}
+
+// IntAttr creates an integer Attr
+func IntAttr(v int64) Attr {
+	return Attr{kind: AttrInt, i: v}
+}
+
+// FloatAttr creates a floating point Attr
+func FloatAttr(v float64) Attr {
+	return Attr{kind: AttrFloat, f: v}
+}
+
+// BoolAttr creates a boolean Attr
+func BoolAttr(v bool) Attr {
+	a := Attr{kind: AttrBool}
+	if v {
+		a.i = 1
+	}
+	return a
+}
+
+// StringAttr creates a string Attr
+func StringAttr(v string) Attr {
+	return Attr{kind: AttrString, s: v}
+}
+
+// TimeAttr creates a time Attr
+func TimeAttr(v time.Time) Attr {
+	return Attr{kind: AttrTime, t: v}
+}
+
+// Kind returns the kind of the value
+func (a Attr) Kind() AttrKind {
+	return a.kind
+}
+
+// AsInt returns the value of an integer Attr
+func (a Attr) AsInt() (int64, bool) {
+	return a.i, a.kind == AttrInt
+}
+
+// AsFloat returns the value of a numeric Attr, integers are converted
+func (a Attr) AsFloat() (float64, bool) {
+	switch a.kind {
+	case AttrFloat:
+		return a.f, true
+	case AttrInt:
+		return float64(a.i), true
+	}
+	return 0, false
+}
+
+// AsBool returns the value of a boolean Attr
+func (a Attr) AsBool() (bool, bool) {
+	return a.i == 1, a.kind == AttrBool
+}
+
+// AsString returns the value of a string Attr
+func (a Attr) AsString() (string, bool) {
+	return a.s, a.kind == AttrString
+}
+
+// AsTime returns the value of a time Attr
+func (a Attr) AsTime() (time.Time, bool) {
+	return a.t, a.kind == AttrTime
+}
+
+// String implements fmt.Stringer
+func (a Attr) String() string {
+	switch a.kind {
+	case AttrInt:
+		return strconv.FormatInt(a.i, 10)
+	case AttrFloat:
+		return strconv.FormatFloat(a.f, 'g', -1, 64)
+	case AttrBool:
+		return strconv.FormatBool(a.i == 1)
+	case AttrString:
+		return a.s
+	case AttrTime:
+		return a.t.Format(time.RFC3339Nano)
+	}
+	return ""
+}
+
+type jsonAttr struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// MarshalJSON implements json.Marshaler. Attrs are encoded
+// as {"type": "int", "value": 42} to keep the kind
+func (a Attr) MarshalJSON() ([]byte, error) {
+	var value interface{}
+	switch a.kind {
+	case AttrInt:
+		value = a.i
+	case AttrFloat:
+		value = a.f
+	case AttrBool:
+		value = a.i == 1
+	case AttrString:
+		value = a.s
+	case AttrTime:
+		value = a.t
+	default:
+		return []byte("null"), nil
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonAttr{Type: attrKindNames[a.kind], Value: raw})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (a *Attr) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*a = Attr{}
+		return nil
+	}
+
+	var ja jsonAttr
+	if err := json.Unmarshal(data, &ja); err != nil {
+		return err
+	}
+
+	var err error
+	switch ja.Type {
+	case "int":
+		var v int64
+		err = json.Unmarshal(ja.Value, &v)
+		*a = IntAttr(v)
+	case "float":
+		var v float64
+		err = json.Unmarshal(ja.Value, &v)
+		*a = FloatAttr(v)
+	case "bool":
+		var v bool
+		err = json.Unmarshal(ja.Value, &v)
+		*a = BoolAttr(v)
+	case "string":
+		var v string
+		err = json.Unmarshal(ja.Value, &v)
+		*a = StringAttr(v)
+	case "time":
+		var v time.Time
+		err = json.Unmarshal(ja.Value, &v)
+		*a = TimeAttr(v)
+	default:
+		err = fmt.Errorf("unknown attr type %q", ja.Type)
+	}
+	return err
+}
+
+// FilterByAttrRange creates an rtreego.Filter passing Attributed objects
+// having a numeric attribute within [min, max]
+func FilterByAttrRange(key string, min float64, max float64) rtreego.Filter {
+	return func(results []rtreego.Spatial, obj rtreego.Spatial) (bool, bool) {
+		attributed, ok := obj.(Attributed)
+		if !ok {
+			return true, false
+		}
+		attr, found := attributed.Attr(key)
+		if !found {
+			return true, false
+		}
+		v, ok := attr.AsFloat()
+		return !ok || v < min || v > max, false
+	}
+}
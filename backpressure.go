@@ -0,0 +1,132 @@
+package spatial
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// BackpressurePolicy defines what a listener does when its consumer
+// doesn't read updates fast enough and the update channel is full
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock makes the listener wait until the consumer reads the update
+	BackpressureBlock BackpressurePolicy = iota
+	// BackpressureDropOldest replaces the pending update with the fresh one
+	BackpressureDropOldest
+	// BackpressureDropNewest drops the fresh update keeping the pending ones
+	BackpressureDropNewest
+	// BackpressureDisconnect waits for the consumer for a while and then
+	// stops the listener with ErrSlowConsumer
+	BackpressureDisconnect
+)
+
+const (
+	// DefaultDisconnectTimeout is the default time BackpressureDisconnect
+	// policy waits for the consumer for
+	DefaultDisconnectTimeout = 5 * time.Second
+)
+
+var (
+	// ErrSlowConsumer is set as the listener error when the listener
+	// is disconnected by the BackpressureDisconnect policy
+	ErrSlowConsumer = errors.New("listener consumer is too slow")
+)
+
+// ListenerOption is a functional option for Server.NewListener
+type ListenerOption func(*Listener)
+
+// WithBackpressure sets the listener backpressure policy, BackpressureBlock is the default
+func WithBackpressure(policy BackpressurePolicy) ListenerOption {
+	return func(l *Listener) {
+		l.backpressure = policy
+	}
+}
+
+// WithDisconnectTimeout sets BackpressureDisconnect policy with a given timeout
+func WithDisconnectTimeout(timeout time.Duration) ListenerOption {
+	return func(l *Listener) {
+		l.backpressure = BackpressureDisconnect
+		l.disconnectTimeout = timeout
+	}
+}
+
+// Dropped returns the number of updates dropped by the backpressure policy
+func (l *Listener) Dropped() uint64 {
+	return atomic.LoadUint64(&l.dropped)
+}
+
+// Err returns the error the listener was stopped with, if any
+func (l *Listener) Err() error {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.err
+}
+
+func (l *Listener) fail(err error) {
+	l.lock.Lock()
+	if l.err == nil {
+		l.err = err
+	}
+	l.lock.Unlock()
+	l.Stop()
+}
+
+// send delivers objects to the update channel according to the backpressure
+// policy. Returns ErrSlowConsumer if the consumer has to be disconnected
+func (l *Listener) send(objects []Indexable) error {
+	return sendTo(l, l.ch, objects, len(objects))
+}
+
+// sendTo delivers an update of n objects to ch according
+// to the listener's backpressure policy
+func sendTo[U any](l *Listener, ch chan U, update U, n int) error {
+	switch l.backpressure {
+	case BackpressureDropNewest:
+		select {
+		case ch <- update:
+			l.recordSent(n)
+		default:
+			atomic.AddUint64(&l.dropped, 1)
+		}
+	case BackpressureDropOldest:
+		for {
+			select {
+			case ch <- update:
+				l.recordSent(n)
+				return nil
+			default:
+			}
+
+			select {
+			case <-ch:
+				atomic.AddUint64(&l.dropped, 1)
+			default:
+				if cap(ch) == 0 {
+					// there's no pending update to replace
+					atomic.AddUint64(&l.dropped, 1)
+					return nil
+				}
+			}
+		}
+	case BackpressureDisconnect:
+		timer := time.NewTimer(l.disconnectTimeout)
+		defer timer.Stop()
+		select {
+		case ch <- update:
+			l.recordSent(n)
+		case <-l.done:
+		case <-timer.C:
+			atomic.AddUint64(&l.dropped, 1)
+			return ErrSlowConsumer
+		}
+	default:
+		select {
+		case ch <- update:
+			l.recordSent(n)
+		case <-l.done:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package spatial
+
+import (
+	"github.com/dhconnelly/rtreego"
+	"github.com/viert/spatial/index"
+)
+
+// BulkLoad replaces all the objects in the server with objs building the index
+// in one pass, which is much faster than adding them one by one. It's meant
+// for startup and snapshot restore, objects added concurrently may get lost.
+// Listeners' areas are kept and all the listeners are notified.
+// If objs contain multiple objects with the same ID the last one is kept,
+// objects with invalid bounds are skipped
+func (s *Server) BulkLoad(objs []Indexable) {
+	idIdx := make(map[string]Indexable, len(objs))
+	for _, obj := range objs {
+		if prepare(obj) == nil {
+			idIdx[obj.ID()] = obj
+		}
+	}
+
+	s.lock.Lock()
+	prev, prevFragments := s.idIdx, s.fragments
+	s.idIdx = make(map[string]Indexable, len(idIdx))
+	s.fragments = make(map[string][]rtreego.Spatial)
+	s.counts = make(map[IndexableType]int)
+	s.versions = make(map[string]uint64, len(idIdx))
+	s.groups = make(map[string]map[string]Indexable)
+	for key, mi := range s.metaIndexes {
+		s.metaIndexes[key] = newMetaIndex(key, mi.kind)
+	}
+	for _, obj := range idIdx {
+		s.storeObject(obj)
+	}
+	groups := make([]string, 0, len(s.groups))
+	for id := range s.groups {
+		groups = append(groups, id)
+	}
+	s.lock.Unlock()
+
+	listeners := s.Listeners()
+	spatials := make([]rtreego.Spatial, 0, len(idIdx)+len(listeners))
+	for _, obj := range idIdx {
+		spatials = append(spatials, s.makeEntries(obj)...)
+	}
+
+	if loader, ok := s.tree.(index.BulkLoader); ok {
+		for _, l := range listeners {
+			for _, box := range l.boxes() {
+				spatials = append(spatials, box)
+			}
+		}
+		loader.BulkLoad(spatials)
+	} else {
+		for id, obj := range prev {
+			if entries, found := prevFragments[id]; found {
+				for _, sp := range entries {
+					s.tree.Delete(sp)
+				}
+			} else {
+				s.tree.Delete(obj)
+			}
+		}
+		for _, sp := range spatials {
+			s.tree.Insert(sp)
+		}
+	}
+
+	for _, obj := range idIdx {
+		s.trackVelocity(obj)
+		for _, l := range s.collectFollowers(obj.ID()) {
+			l.followMoved(obj)
+		}
+	}
+
+	monitors := s.collectMonitors()
+	for _, m := range monitors {
+		for id, obj := range prev {
+			if _, found := idIdx[id]; !found {
+				m.forget(obj)
+			}
+		}
+		for _, obj := range idIdx {
+			m.check(obj)
+		}
+	}
+
+	for _, id := range groups {
+		s.refreshGroup(id)
+	}
+
+	for _, l := range listeners {
+		l.setDirty()
+	}
+}
@@ -0,0 +1,178 @@
+package spatial
+
+import (
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ListenerEvent describes changes of a listener's view since the previous event
+type ListenerEvent struct {
+	Added   []Indexable
+	Updated []Indexable
+	Removed []Indexable
+	// Versions holds server versions (see Server.Version) of added
+	// and updated objects. Objects replaced while the event was being
+	// built have no version here, a newer event follows for them
+	Versions map[string]uint64
+}
+
+// Empty returns true if the event carries no changes
+func (e *ListenerEvent) Empty() bool {
+	return len(e.Added) == 0 && len(e.Updated) == 0 && len(e.Removed) == 0
+}
+
+// workerPool runs listener callbacks on a fixed number of goroutines
+type workerPool struct {
+	size int
+	jobs chan func()
+	once sync.Once
+}
+
+func newWorkerPool(size int) *workerPool {
+	if size < 1 {
+		size = runtime.NumCPU()
+	}
+	return &workerPool{
+		size: size,
+		jobs: make(chan func(), size*16),
+	}
+}
+
+func (p *workerPool) start() {
+	for i := 0; i < p.size; i++ {
+		go func() {
+			for job := range p.jobs {
+				job()
+			}
+		}()
+	}
+}
+
+func (p *workerPool) submit(job func()) {
+	p.once.Do(p.start)
+	p.jobs <- job
+}
+
+func withCallback(fn func([]Indexable)) ListenerOption {
+	return func(l *Listener) {
+		l.callback = fn
+	}
+}
+
+// NewCallbackListener creates and returns a new listener calling fn with every
+// update instead of sending it through a channel. Callbacks are run by the server's
+// worker pool, calls for the same listener never overlap. If the callback is slower
+// than updates come, the pending update is replaced with the fresh one and
+// counted as dropped. Panics in fn are recovered and counted
+func (s *Server) NewCallbackListener(fn func([]Indexable), interval time.Duration, opts ...ListenerOption) *Listener {
+	return newListener(s, 0, interval, append(opts, withCallback(fn))...)
+}
+
+// NewEventCallbackListener is like NewCallbackListener, but fn is called with
+// changes of the listener's view since the previous call
+func (s *Server) NewEventCallbackListener(fn func(ListenerEvent), interval time.Duration, opts ...ListenerOption) *Listener {
+	prev := make(map[string]Indexable)
+	prevVersions := make(map[string]uint64)
+	// callbacks of a listener are serialized so prev needs no locking
+	cb := func(objects []Indexable) {
+		var ev ListenerEvent
+		curr := make(map[string]Indexable)
+		versions := s.versionsOf(objects)
+		for _, obj := range objects {
+			curr[obj.ID()] = obj
+			if p, found := prev[obj.ID()]; !found {
+				ev.Added = append(ev.Added, obj)
+			} else if !sameIndexable(p, obj) || changedVersion(versions, prevVersions, obj.ID()) {
+				// objects modified in place, e.g. by UpdateMeta, change versions only
+				ev.Updated = append(ev.Updated, obj)
+			}
+		}
+		for id, obj := range prev {
+			if _, found := curr[id]; !found {
+				ev.Removed = append(ev.Removed, obj)
+			}
+		}
+		prev = curr
+		prevVersions = versions
+		if !ev.Empty() {
+			ev.Versions = make(map[string]uint64, len(ev.Added)+len(ev.Updated))
+			for _, obj := range append(ev.Added, ev.Updated...) {
+				if v, found := versions[obj.ID()]; found {
+					ev.Versions[obj.ID()] = v
+				}
+			}
+			fn(ev)
+		}
+	}
+	return s.NewCallbackListener(cb, interval, opts...)
+}
+
+// changedVersion checks if the server version of a current object has changed
+func changedVersion(versions map[string]uint64, prevVersions map[string]uint64, id string) bool {
+	v, found := versions[id]
+	return found && v != prevVersions[id]
+}
+
+// sameIndexable compares objects by identity where possible
+func sameIndexable(a Indexable, b Indexable) bool {
+	if reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// Panics returns the number of panics recovered from the listener's callback
+func (l *Listener) Panics() uint64 {
+	return atomic.LoadUint64(&l.panics)
+}
+
+func (l *Listener) dispatch(objects []Indexable) {
+	l.cbLock.Lock()
+	if l.cbHasPending {
+		atomic.AddUint64(&l.dropped, 1)
+	}
+	l.cbPending = objects
+	l.cbHasPending = true
+	scheduled := l.cbScheduled
+	l.cbScheduled = true
+	l.cbLock.Unlock()
+
+	if !scheduled {
+		l.srv.pool.submit(l.runCallbacks)
+	}
+}
+
+func (l *Listener) runCallbacks() {
+	for {
+		l.cbLock.Lock()
+		if !l.cbHasPending {
+			l.cbScheduled = false
+			l.cbLock.Unlock()
+			return
+		}
+		objects := l.cbPending
+		l.cbPending = nil
+		l.cbHasPending = false
+		l.cbLock.Unlock()
+
+		select {
+		case <-l.done:
+			// stopped listeners don't call back anymore
+		default:
+			l.invoke(objects)
+		}
+	}
+}
+
+func (l *Listener) invoke(objects []Indexable) {
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddUint64(&l.panics, 1)
+		}
+	}()
+	l.recordSent(len(objects))
+	l.callback(objects)
+}
@@ -0,0 +1,83 @@
+package spatial
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const (
+	// number of mutexes writes to objects are serialized with,
+	// objects with ids having the same hash share a mutex
+	idLockStripes = 256
+)
+
+func (s *Server) idLock(id string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return &s.idLocks[h.Sum32()%idLockStripes]
+}
+
+// Version returns the current version of an object with a given id or 0
+// if there's no such object. The version changes every time the object
+// is written, so it can be used for optimistic concurrency control
+func (s *Server) Version(id string) uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.versions[id]
+}
+
+// AddIfAbsent adds an object only if there's no object with the same ID().
+// Returns false if the object was not added
+func (s *Server) AddIfAbsent(obj Indexable) bool {
+	return s.UpdateIfVersion(obj, 0)
+}
+
+// UpdateIfVersion adds or modifies an object only if the current version
+// of the object with the same ID() is expectedVersion, zero version stands
+// for an absent object. Returns false if the object was not written
+// including the cases of a stale Versioned object and invalid bounds
+func (s *Server) UpdateIfVersion(obj Indexable, expectedVersion uint64) bool {
+	if prepare(obj) != nil {
+		return false
+	}
+
+	return s.addIf(obj, time.Now(), func() bool {
+		return s.Version(obj.ID()) == expectedVersion
+	})
+}
+
+// CompareAndSwap replaces old with next only if old is still the current
+// object with its ID(), objects are compared by identity. Both objects
+// must have the same ID(). Returns false if the object was not replaced
+func (s *Server) CompareAndSwap(old Indexable, next Indexable) bool {
+	if old.ID() != next.ID() || prepare(next) != nil {
+		return false
+	}
+
+	return s.addIf(next, time.Now(), func() bool {
+		curr, found := s.Get(old.ID())
+		return found && sameIndexable(curr, old)
+	})
+}
+
+// addIf does add under the object's id lock if cond, checked under the lock
+// as well, holds or is nil. Groups are refreshed once the lock is released.
+// Only successful writes are recorded in metrics
+func (s *Server) addIf(obj Indexable, start time.Time, cond func() bool) bool {
+	lock := s.idLock(obj.ID())
+	lock.Lock()
+	if cond != nil && !cond() {
+		lock.Unlock()
+		return false
+	}
+	curr, ok := s.add(obj)
+	lock.Unlock()
+	if !ok {
+		return false
+	}
+
+	s.refreshGroups(curr, obj)
+	s.getMetrics().observeAdd(start)
+	return true
+}
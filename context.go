@@ -0,0 +1,33 @@
+package spatial
+
+import (
+	"context"
+	"time"
+)
+
+// WithContext ties the listener lifetime to ctx. When the context is done
+// the listener is stopped with the context's error
+func WithContext(ctx context.Context) ListenerOption {
+	return func(l *Listener) {
+		l.ctx = ctx
+	}
+}
+
+// NewListenerContext creates and returns a new listener stopped
+// as soon as ctx is done
+func (s *Server) NewListenerContext(ctx context.Context, chSize int, interval time.Duration, opts ...ListenerOption) *Listener {
+	return s.NewListener(chSize, interval, append(opts, WithContext(ctx))...)
+}
+
+// Done returns a channel closed when the listener is stopped
+func (l *Listener) Done() <-chan struct{} {
+	return l.done
+}
+
+func (l *Listener) watchContext() {
+	select {
+	case <-l.ctx.Done():
+		l.fail(l.ctx.Err())
+	case <-l.done:
+	}
+}
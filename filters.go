@@ -25,4 +25,10 @@ func FilterByTypes(types []IndexableType) rtreego.Filter {
 
 var (
 	filterBoundingBoxes = FilterByTypes([]IndexableType{itBoundingBox})
+
+	// filterObjects refuses everything but user objects
+	filterObjects rtreego.Filter = func(results []rtreego.Spatial, obj rtreego.Spatial) (bool, bool) {
+		idxbl, ok := obj.(Indexable)
+		return !ok || idxbl.Type() <= 0, false
+	}
 )
@@ -1,5 +1,5 @@
 module github.com/viert/spatial
 
-go 1.14
+go 1.18
 
 require github.com/dhconnelly/rtreego v1.0.0
@@ -0,0 +1,196 @@
+package spatial
+
+import (
+	"math"
+	"sort"
+
+	"github.com/dhconnelly/rtreego"
+)
+
+const (
+	// GroupType is the type of server-managed groups, it must not be used
+	// for other objects
+	GroupType IndexableType = math.MaxInt32
+
+	// minGroupSize is the minimal size of group bounds
+	minGroupSize = 1e-9
+)
+
+// GroupMode defines whether a listener receives groups, their members or both
+type GroupMode int
+
+const (
+	// GroupModeBoth sends both groups and their members, it's the default
+	GroupModeBoth GroupMode = iota
+	// GroupModeGroups sends groups instead of their members
+	GroupModeGroups
+	// GroupModeMembers sends members without their groups
+	GroupModeMembers
+)
+
+// Child is implemented by objects belonging to a group. Objects with a non-empty
+// ParentID() make the server maintain a Group with that ID whose bounds are
+// the union of its members' bounds. Group IDs must not be used by other objects
+type Child interface {
+	ParentID() string
+}
+
+// Group is a server-managed object representing a number of objects with the same
+// parent ID, e.g. a formation or a convoy. Groups are immutable, a new Group
+// replaces the previous one every time members change
+type Group struct {
+	id      string
+	bounds  *rtreego.Rect
+	members []string
+}
+
+// ID implements Indexable
+func (g *Group) ID() string {
+	return g.id
+}
+
+// Bounds implements Indexable
+func (g *Group) Bounds() *rtreego.Rect {
+	return g.bounds
+}
+
+// Ref implements Indexable
+func (g *Group) Ref() interface{} {
+	return nil
+}
+
+// Type implements Indexable
+func (g *Group) Type() IndexableType {
+	return GroupType
+}
+
+// Members returns sorted IDs of the group members
+func (g *Group) Members() []string {
+	return append([]string{}, g.members...)
+}
+
+// parentOf returns the parent ID of an object, obj may be nil
+func parentOf(obj Indexable) string {
+	if p, ok := obj.(*Predicted); ok {
+		obj = p.Original()
+	}
+	if child, ok := obj.(Child); ok {
+		return child.ParentID()
+	}
+	return ""
+}
+
+// trackMember updates group membership after curr is replaced with obj,
+// either of them may be nil. The server lock must be held
+func (s *Server) trackMember(curr Indexable, obj Indexable) {
+	if parent := parentOf(curr); parent != "" {
+		delete(s.groups[parent], curr.ID())
+		if len(s.groups[parent]) == 0 {
+			delete(s.groups, parent)
+		}
+	}
+	if parent := parentOf(obj); parent != "" {
+		if _, found := s.groups[parent]; !found {
+			s.groups[parent] = make(map[string]Indexable)
+		}
+		s.groups[parent][obj.ID()] = obj
+	}
+}
+
+// refreshGroups rebuilds groups of curr and obj, either of them may be nil
+func (s *Server) refreshGroups(curr Indexable, obj Indexable) {
+	prev, next := parentOf(curr), parentOf(obj)
+	if prev != "" && prev != next {
+		s.refreshGroup(prev)
+	}
+	if next != "" {
+		s.refreshGroup(next)
+	}
+}
+
+// refreshGroup replaces a group with a new one built out of its current
+// members or removes it if there are no members left
+func (s *Server) refreshGroup(id string) {
+	// the group lock serializes rebuilds of groups, the group's id lock
+	// is taken for the write like public write paths do. Callers must not
+	// hold any id lock, ids of a group and its members may share a stripe
+	s.groupLock.Lock()
+	defer s.groupLock.Unlock()
+
+	s.lock.RLock()
+	members := make([]string, 0, len(s.groups[id]))
+	lngs := make([][2]float64, 0, len(s.groups[id]))
+	latLo, latHi := math.Inf(1), math.Inf(-1)
+	for memberID, member := range s.groups[id] {
+		members = append(members, memberID)
+		r := member.Bounds()
+		latLo = math.Min(latLo, r.PointCoord(0))
+		latHi = math.Max(latHi, r.PointCoord(0)+r.LengthsCoord(0))
+		lngs = append(lngs, [2]float64{r.PointCoord(1), r.LengthsCoord(1)})
+	}
+	s.lock.RUnlock()
+
+	lock := s.idLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+	if len(members) == 0 {
+		curr, _ := s.Get(id)
+		if _, isGroup := curr.(*Group); isGroup {
+			s.remove(id)
+		}
+		return
+	}
+
+	sort.Strings(members)
+	lngLo, lngSize := coveringArc(lngs)
+	// rtreego refuses rects with zero lengths
+	lengths := []float64{math.Max(latHi-latLo, minGroupSize), math.Max(lngSize, minGroupSize)}
+	bounds, _ := rtreego.NewRect(rtreego.Point{latLo, lngLo}, lengths)
+	s.add(&Group{id: id, bounds: bounds, members: members})
+}
+
+// coveringArc returns the start and the length of the shortest longitude arc
+// covering all the given {start, length} arcs, so groups with members on both
+// sides of the antimeridian cross it instead of spanning the whole world.
+// The arc may end beyond 180, such groups are indexed as fragments
+func coveringArc(arcs [][2]float64) (float64, float64) {
+	best := math.Inf(1)
+	bestLo := -180.0
+	// the shortest arc starts where one of the arcs does
+	for _, start := range arcs {
+		lo := wrapLongitude(start[0])
+		length := 0.0
+		for _, arc := range arcs {
+			offset := math.Mod(wrapLongitude(arc[0])-lo+360, 360)
+			length = math.Max(length, offset+arc[1])
+		}
+		if length < best {
+			best, bestLo = length, lo
+		}
+	}
+	if best >= 360 {
+		return -180, 360
+	}
+	return bestLo, best
+}
+
+// SetGroupMode sets whether the listener receives groups, their members
+// or both. Does not apply for ID subscriptions
+func (l *Listener) SetGroupMode(mode GroupMode) {
+	l.lock.Lock()
+	l.groupMode = mode
+	l.lock.Unlock()
+	l.setDirty()
+}
+
+// skipByGroupMode checks if an object found in the listener's areas
+// shouldn't be sent according to the group mode
+func skipByGroupMode(mode GroupMode, obj Indexable) bool {
+	switch mode {
+	case GroupModeGroups:
+		return parentOf(obj) != ""
+	case GroupModeMembers:
+		return obj.Type() == GroupType
+	}
+	return false
+}
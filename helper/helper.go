@@ -6,6 +6,13 @@ import (
 	"github.com/dhconnelly/rtreego"
 )
 
+const (
+	earthRadiusNM = 3440.065
+	// longitude degree becomes infinitely small near the poles,
+	// corrections are limited by this latitude
+	maxCorrectionLatitude = 89.0
+)
+
 func nmToLatLon(latSizeNM float64, lngSizeNM float64, atLatitude float64) []float64 {
 	// for latitude 60nm is 1˚
 	latSize := (1.0 / 60) * latSizeNM
@@ -21,6 +28,11 @@ func nmToLatLon(latSizeNM float64, lngSizeNM float64, atLatitude float64) []floa
 	return []float64{latSize, lngSize}
 }
 
+// correctionLatitude limits the latitude longitude corrections are taken for
+func correctionLatitude(lat float64) float64 {
+	return math.Min(math.Abs(lat), maxCorrectionLatitude)
+}
+
 // Square makes square bounds of a given size
 // Lat and Lng represent top left angle of the square
 func Square(lat float64, lng float64, sizeNM float64) *rtreego.Rect {
@@ -38,3 +50,56 @@ func SquareCentered(lat float64, lng float64, sizeNM float64) *rtreego.Rect {
 	lng = lng - sizes[1]
 	return Square(lat, lng, sizeNM)
 }
+
+// Center returns latitude and longitude of the center of given bounds
+func Center(rect *rtreego.Rect) (float64, float64) {
+	lat := rect.PointCoord(0) + rect.LengthsCoord(0)/2
+	lng := rect.PointCoord(1) + rect.LengthsCoord(1)/2
+	return lat, lng
+}
+
+// Offset moves bounds by a given distance in nautical miles
+// in a given direction (heading in degrees, 0 is north, 90 is east)
+func Offset(rect *rtreego.Rect, distanceNM float64, heading float64) *rtreego.Rect {
+	headingRad := (heading * 2 * math.Pi) / 360
+	lat, _ := Center(rect)
+	sizes := nmToLatLon(
+		distanceNM*math.Cos(headingRad),
+		distanceNM*math.Sin(headingRad),
+		correctionLatitude(lat),
+	)
+	p := rtreego.Point{rect.PointCoord(0) + sizes[0], rect.PointCoord(1) + sizes[1]}
+	moved, _ := rtreego.NewRect(p, []float64{rect.LengthsCoord(0), rect.LengthsCoord(1)})
+	return moved
+}
+
+// Expand grows bounds by a given distance in nautical miles in every direction
+func Expand(rect *rtreego.Rect, distanceNM float64) *rtreego.Rect {
+	// longitude correction is taken for the latitude closest to a pole
+	// so the expanded bounds are never smaller than requested
+	atLatitude := math.Max(
+		math.Abs(rect.PointCoord(0)),
+		math.Abs(rect.PointCoord(0)+rect.LengthsCoord(0)),
+	)
+	sizes := nmToLatLon(distanceNM, distanceNM, correctionLatitude(atLatitude))
+	p := rtreego.Point{rect.PointCoord(0) - sizes[0], rect.PointCoord(1) - sizes[1]}
+	expanded, _ := rtreego.NewRect(p, []float64{
+		rect.LengthsCoord(0) + 2*sizes[0],
+		rect.LengthsCoord(1) + 2*sizes[1],
+	})
+	return expanded
+}
+
+// DistanceNM calculates great-circle distance in nautical miles
+// between two points given by their latitude and longitude
+func DistanceNM(lat1 float64, lng1 float64, lat2 float64, lng2 float64) float64 {
+	phi1 := (lat1 * 2 * math.Pi) / 360
+	phi2 := (lat2 * 2 * math.Pi) / 360
+	dPhi := phi2 - phi1
+	dLambda := ((lng2 - lng1) * 2 * math.Pi) / 360
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	return earthRadiusNM * c
+}
@@ -0,0 +1,248 @@
+package index
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dhconnelly/rtreego"
+	"github.com/viert/spatial/internal/rtreeutil"
+)
+
+// Reader is the read-only part of Index
+type Reader interface {
+	SearchIntersect(bb *rtreego.Rect, filters ...rtreego.Filter) []rtreego.Spatial
+	Nearest(p rtreego.Point, k int, filters ...rtreego.Filter) []rtreego.Spatial
+	Len() int
+}
+
+// Snapshotter is implemented by indexes able to provide a consistent
+// point-in-time view for a series of searches
+type Snapshotter interface {
+	Snapshot() Reader
+}
+
+// Batcher is implemented by indexes able to apply a number
+// of changes atomically
+type Batcher interface {
+	Batch(deletes []rtreego.Spatial, inserts []rtreego.Spatial)
+}
+
+// cowVersion is an immutable state of COW index: an R-tree built at some
+// point in the past and the changes made since then
+type cowVersion struct {
+	base     *rtreego.Rtree
+	baseObjs map[rtreego.Spatial]struct{}
+	added    []rtreego.Spatial
+	deleted  map[rtreego.Spatial]struct{}
+	count    int
+}
+
+func (v *cowVersion) notDeleted(results []rtreego.Spatial, obj rtreego.Spatial) (bool, bool) {
+	_, found := v.deleted[obj]
+	return found, false
+}
+
+// SearchIntersect implements Reader
+func (v *cowVersion) SearchIntersect(bb *rtreego.Rect, filters ...rtreego.Filter) []rtreego.Spatial {
+	results := v.base.SearchIntersect(bb, append([]rtreego.Filter{v.notDeleted}, filters...)...)
+	for _, obj := range v.added {
+		if !rtreeutil.Intersects(obj.Bounds(), bb) {
+			continue
+		}
+		refuse, abort := rtreeutil.ApplyFilters(results, obj, filters)
+		if !refuse {
+			results = append(results, obj)
+		}
+		if abort {
+			break
+		}
+	}
+	return results
+}
+
+// Nearest implements Reader
+func (v *cowVersion) Nearest(p rtreego.Point, k int, filters ...rtreego.Filter) []rtreego.Spatial {
+	results := v.base.NearestNeighbors(k, p, append([]rtreego.Filter{v.notDeleted}, filters...)...)
+	if len(v.added) == 0 {
+		return results
+	}
+
+	results = append(results, nearest(append([]rtreego.Spatial{}, v.added...), p, k, filters)...)
+	sort.SliceStable(results, func(i, j int) bool {
+		return rtreeutil.MinDist(p, results[i].Bounds()) < rtreeutil.MinDist(p, results[j].Bounds())
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// Len implements Reader
+func (v *cowVersion) Len() int {
+	return v.count
+}
+
+// COW is a copy-on-write index. Every change publishes a new immutable
+// version through an atomic pointer, so readers never block and always
+// see a consistent state. Changes are accumulated on top of an R-tree which
+// is rebuilt with bulk loading once there are more than maxDelta of them
+type COW struct {
+	current   atomic.Value
+	writeLock sync.Mutex
+	minBranch int
+	maxBranch int
+	maxDelta  int
+}
+
+// NewCOW creates a new COW index
+func NewCOW(minBranch int, maxBranch int, maxDelta int) *COW {
+	c := &COW{
+		minBranch: minBranch,
+		maxBranch: maxBranch,
+		maxDelta:  maxDelta,
+	}
+	c.current.Store(&cowVersion{
+		base:     rtreego.NewTree(2, minBranch, maxBranch),
+		baseObjs: make(map[rtreego.Spatial]struct{}),
+		deleted:  make(map[rtreego.Spatial]struct{}),
+	})
+	return c
+}
+
+func (c *COW) load() *cowVersion {
+	return c.current.Load().(*cowVersion)
+}
+
+// Snapshot implements Snapshotter
+func (c *COW) Snapshot() Reader {
+	return c.load()
+}
+
+// rebuild makes a fresh base tree out of all the objects of a version
+func (c *COW) rebuild(v *cowVersion) *cowVersion {
+	objs := make([]rtreego.Spatial, 0, v.count)
+	baseObjs := make(map[rtreego.Spatial]struct{}, v.count)
+	for obj := range v.baseObjs {
+		if _, found := v.deleted[obj]; !found {
+			objs = append(objs, obj)
+			baseObjs[obj] = struct{}{}
+		}
+	}
+	for _, obj := range v.added {
+		objs = append(objs, obj)
+		baseObjs[obj] = struct{}{}
+	}
+	return &cowVersion{
+		base:     rtreego.NewTree(2, c.minBranch, c.maxBranch, objs...),
+		baseObjs: baseObjs,
+		deleted:  make(map[rtreego.Spatial]struct{}),
+		count:    v.count,
+	}
+}
+
+// apply makes a new version with changes applied, returns
+// the number of objects actually deleted
+func (c *COW) apply(deletes []rtreego.Spatial, inserts []rtreego.Spatial) int {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	prev := c.load()
+	v := &cowVersion{
+		base:     prev.base,
+		baseObjs: prev.baseObjs,
+		added:    make([]rtreego.Spatial, len(prev.added), len(prev.added)+len(inserts)),
+		deleted:  make(map[rtreego.Spatial]struct{}, len(prev.deleted)),
+		count:    prev.count,
+	}
+	copy(v.added, prev.added)
+	for obj := range prev.deleted {
+		v.deleted[obj] = struct{}{}
+	}
+
+	deleted := 0
+	for _, obj := range deletes {
+		if c.deleteFrom(v, obj) {
+			deleted++
+		}
+	}
+	v.added = append(v.added, inserts...)
+	v.count += len(inserts)
+
+	if len(v.added)+len(v.deleted) > c.maxDelta {
+		v = c.rebuild(v)
+	}
+	c.current.Store(v)
+	return deleted
+}
+
+func (c *COW) deleteFrom(v *cowVersion, obj rtreego.Spatial) bool {
+	for i, added := range v.added {
+		if added == obj {
+			v.added = append(v.added[:i], v.added[i+1:]...)
+			v.count--
+			return true
+		}
+	}
+	if _, found := v.baseObjs[obj]; found {
+		if _, found := v.deleted[obj]; !found {
+			v.deleted[obj] = struct{}{}
+			v.count--
+			return true
+		}
+	}
+	return false
+}
+
+// Insert implements Index
+func (c *COW) Insert(obj rtreego.Spatial) {
+	c.apply(nil, []rtreego.Spatial{obj})
+}
+
+// Delete implements Index
+func (c *COW) Delete(obj rtreego.Spatial) bool {
+	return c.apply([]rtreego.Spatial{obj}, nil) > 0
+}
+
+// Batch implements Batcher, all the changes are published as one version
+func (c *COW) Batch(deletes []rtreego.Spatial, inserts []rtreego.Spatial) {
+	c.apply(deletes, inserts)
+}
+
+// SearchIntersect implements Index, it never blocks
+func (c *COW) SearchIntersect(bb *rtreego.Rect, filters ...rtreego.Filter) []rtreego.Spatial {
+	return c.load().SearchIntersect(bb, filters...)
+}
+
+// Nearest implements Index, it never blocks
+func (c *COW) Nearest(p rtreego.Point, k int, filters ...rtreego.Filter) []rtreego.Spatial {
+	return c.load().Nearest(p, k, filters...)
+}
+
+// Len implements Index
+func (c *COW) Len() int {
+	return c.load().Len()
+}
+
+// Depth implements Depther
+func (c *COW) Depth() int {
+	return c.load().base.Depth()
+}
+
+// BulkLoad implements BulkLoader, objs become the base of a new version
+func (c *COW) BulkLoad(objs []rtreego.Spatial) {
+	baseObjs := make(map[rtreego.Spatial]struct{}, len(objs))
+	for _, obj := range objs {
+		baseObjs[obj] = struct{}{}
+	}
+	v := &cowVersion{
+		base:     rtreego.NewTree(2, c.minBranch, c.maxBranch, objs...),
+		baseObjs: baseObjs,
+		deleted:  make(map[rtreego.Spatial]struct{}),
+		count:    len(objs),
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.current.Store(v)
+}
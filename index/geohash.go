@@ -0,0 +1,225 @@
+package index
+
+import (
+	"math"
+	"sync"
+
+	"github.com/dhconnelly/rtreego"
+)
+
+const (
+	geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+)
+
+// geohashBox is a cell of the geohash grid, dimension 0 is latitude
+// and dimension 1 is longitude
+type geohashBox struct {
+	lo [2]float64
+	hi [2]float64
+}
+
+var (
+	geohashWorld = geohashBox{lo: [2]float64{-90, -180}, hi: [2]float64{90, 180}}
+)
+
+// child returns a box of the next level cell. Bits of a geohash
+// alternate starting with longitude, each character holds 5 bits
+func (b geohashBox) child(level int, ch int) geohashBox {
+	for i := 4; i >= 0; i-- {
+		bit := (ch >> uint(i)) & 1
+		// overall bit number defines the dimension being split
+		dim := 0
+		if (level*5+4-i)%2 == 0 {
+			dim = 1
+		}
+		mid := (b.lo[dim] + b.hi[dim]) / 2
+		if bit == 1 {
+			b.lo[dim] = mid
+		} else {
+			b.hi[dim] = mid
+		}
+	}
+	return b
+}
+
+// clampedGeohashBox returns the box of a rect clamped to the world the same
+// way encodeGeohash clamps points, so objects outside the world put into
+// edge buckets are found by searches for them
+func clampedGeohashBox(r *rtreego.Rect) geohashBox {
+	var b geohashBox
+	for i := 0; i < 2; i++ {
+		b.lo[i] = math.Max(geohashWorld.lo[i], math.Min(geohashWorld.hi[i], r.PointCoord(i)))
+		b.hi[i] = math.Max(geohashWorld.lo[i], math.Min(geohashWorld.hi[i], r.PointCoord(i)+r.LengthsCoord(i)))
+	}
+	return b
+}
+
+func (b geohashBox) intersects(other geohashBox) bool {
+	for i := 0; i < 2; i++ {
+		if other.hi[i] < b.lo[i] || other.lo[i] > b.hi[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeGeohash returns a geohash of a given precision for a point
+func encodeGeohash(lat float64, lng float64, precision int) string {
+	lat = math.Max(-90, math.Min(90, lat))
+	lng = math.Max(-180, math.Min(180, lng))
+
+	hash := make([]byte, precision)
+	box := geohashWorld
+	for level := 0; level < precision; level++ {
+		ch := 0
+		for i := 4; i >= 0; i-- {
+			dim, v := 0, lat
+			if (level*5+4-i)%2 == 0 {
+				dim, v = 1, lng
+			}
+			mid := (box.lo[dim] + box.hi[dim]) / 2
+			if v >= mid {
+				ch |= 1 << uint(i)
+				box.lo[dim] = mid
+			} else {
+				box.hi[dim] = mid
+			}
+		}
+		hash[level] = geohashAlphabet[ch]
+	}
+	return string(hash)
+}
+
+// Geohash is a geohash bucket index. Every object is put into a bucket
+// of the longest geohash prefix fully containing it. It works best for
+// lat/lng data with point-like objects, dimension 0 is considered
+// latitude and dimension 1 is longitude
+type Geohash struct {
+	lock      sync.RWMutex
+	precision int
+	buckets   map[string]map[rtreego.Spatial]struct{}
+	// counts holds numbers of objects in buckets under each prefix
+	counts map[string]int
+	where  map[rtreego.Spatial]string
+}
+
+// NewGeohash creates a new Geohash index with buckets up to a given precision
+func NewGeohash(precision int) *Geohash {
+	return &Geohash{
+		precision: precision,
+		buckets:   make(map[string]map[rtreego.Spatial]struct{}),
+		counts:    make(map[string]int),
+		where:     make(map[rtreego.Spatial]string),
+	}
+}
+
+func (g *Geohash) bucketFor(r *rtreego.Rect) string {
+	sw := encodeGeohash(r.PointCoord(0), r.PointCoord(1), g.precision)
+	ne := encodeGeohash(r.PointCoord(0)+r.LengthsCoord(0), r.PointCoord(1)+r.LengthsCoord(1), g.precision)
+	i := 0
+	for i < len(sw) && sw[i] == ne[i] {
+		i++
+	}
+	return sw[:i]
+}
+
+// Insert implements Index
+func (g *Geohash) Insert(obj rtreego.Spatial) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	bucket := g.bucketFor(obj.Bounds())
+	if _, found := g.buckets[bucket]; !found {
+		g.buckets[bucket] = make(map[rtreego.Spatial]struct{})
+	}
+	g.buckets[bucket][obj] = struct{}{}
+	g.where[obj] = bucket
+	for i := 0; i <= len(bucket); i++ {
+		g.counts[bucket[:i]]++
+	}
+}
+
+// Delete implements Index
+func (g *Geohash) Delete(obj rtreego.Spatial) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	bucket, found := g.where[obj]
+	if !found {
+		return false
+	}
+	delete(g.buckets[bucket], obj)
+	if len(g.buckets[bucket]) == 0 {
+		delete(g.buckets, bucket)
+	}
+	delete(g.where, obj)
+	for i := 0; i <= len(bucket); i++ {
+		g.counts[bucket[:i]]--
+		if g.counts[bucket[:i]] == 0 {
+			delete(g.counts, bucket[:i])
+		}
+	}
+	return true
+}
+
+func (g *Geohash) collect(prefix string, box geohashBox, bb geohashBox, candidates []rtreego.Spatial) []rtreego.Spatial {
+	for obj := range g.buckets[prefix] {
+		candidates = append(candidates, obj)
+	}
+	if len(prefix) >= g.precision {
+		return candidates
+	}
+	for ch := 0; ch < len(geohashAlphabet); ch++ {
+		child := prefix + string(geohashAlphabet[ch])
+		if g.counts[child] == 0 {
+			continue
+		}
+		if childBox := box.child(len(prefix), ch); childBox.intersects(bb) {
+			candidates = g.collect(child, childBox, bb, candidates)
+		}
+	}
+	return candidates
+}
+
+// SearchIntersect implements Index
+func (g *Geohash) SearchIntersect(bb *rtreego.Rect, filters ...rtreego.Filter) []rtreego.Spatial {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	candidates := g.collect("", geohashWorld, clampedGeohashBox(bb), make([]rtreego.Spatial, 0))
+	return search(candidates, bb, filters)
+}
+
+// Nearest implements Index. Objects spanning cell borders are kept in short
+// prefix buckets, so all of them are sorted by distance
+func (g *Geohash) Nearest(p rtreego.Point, k int, filters ...rtreego.Filter) []rtreego.Spatial {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	candidates := make([]rtreego.Spatial, 0, len(g.where))
+	for obj := range g.where {
+		candidates = append(candidates, obj)
+	}
+	return nearest(candidates, p, k, filters)
+}
+
+// Len implements Index
+func (g *Geohash) Len() int {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	return len(g.where)
+}
+
+// BulkLoad implements BulkLoader. The new buckets are filled in
+// while the current ones are still available for searches
+func (g *Geohash) BulkLoad(objs []rtreego.Spatial) {
+	fresh := NewGeohash(g.precision)
+	for _, obj := range objs {
+		fresh.Insert(obj)
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.buckets = fresh.buckets
+	g.counts = fresh.counts
+	g.where = fresh.where
+}
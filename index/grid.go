@@ -0,0 +1,186 @@
+package index
+
+import (
+	"math"
+	"sync"
+
+	"github.com/dhconnelly/rtreego"
+)
+
+const (
+	// objects covering more cells than this are kept out of the grid
+	// and checked on every search
+	gridMaxCells = 1024
+)
+
+var (
+	// coordinates are clamped to these limits when mapped to cells, so
+	// huge rects can't overflow cell numbers. Longitudes are allowed to go
+	// a full turn beyond the antimeridian
+	gridLo = [2]float64{-90, -360}
+	gridHi = [2]float64{90, 360}
+)
+
+type gridCell struct {
+	x int64
+	y int64
+}
+
+// Grid is a uniform grid index. It's the best choice for dense
+// point-like data with objects much smaller than the cell size
+type Grid struct {
+	lock     sync.RWMutex
+	cellSize float64
+	cells    map[gridCell]map[rtreego.Spatial]struct{}
+	objects  map[rtreego.Spatial][]gridCell
+	large    map[rtreego.Spatial]struct{}
+}
+
+// NewGrid creates a new Grid with square cells of a given size
+func NewGrid(cellSize float64) *Grid {
+	return &Grid{
+		cellSize: cellSize,
+		cells:    make(map[gridCell]map[rtreego.Spatial]struct{}),
+		objects:  make(map[rtreego.Spatial][]gridCell),
+		large:    make(map[rtreego.Spatial]struct{}),
+	}
+}
+
+// cell returns a cell number of a coordinate in a given dimension
+func (g *Grid) cell(dim int, v float64) int64 {
+	v = math.Max(gridLo[dim], math.Min(gridHi[dim], v))
+	return int64(math.Floor(v / g.cellSize))
+}
+
+// cellRange returns the lowest and the highest cells covered by a rect
+func (g *Grid) cellRange(r *rtreego.Rect) (gridCell, gridCell) {
+	lo := gridCell{g.cell(0, r.PointCoord(0)), g.cell(1, r.PointCoord(1))}
+	hi := gridCell{
+		g.cell(0, r.PointCoord(0)+r.LengthsCoord(0)),
+		g.cell(1, r.PointCoord(1)+r.LengthsCoord(1)),
+	}
+	return lo, hi
+}
+
+// cellCount returns the number of cells between lo and hi, it's a float
+// so tiny cells can't overflow it
+func cellCount(lo gridCell, hi gridCell) float64 {
+	return float64(hi.x-lo.x+1) * float64(hi.y-lo.y+1)
+}
+
+// Insert implements Index
+func (g *Grid) Insert(obj rtreego.Spatial) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	lo, hi := g.cellRange(obj.Bounds())
+	if cellCount(lo, hi) > gridMaxCells {
+		g.large[obj] = struct{}{}
+		g.objects[obj] = nil
+		return
+	}
+
+	cells := make([]gridCell, 0)
+	for x := lo.x; x <= hi.x; x++ {
+		for y := lo.y; y <= hi.y; y++ {
+			c := gridCell{x, y}
+			if _, found := g.cells[c]; !found {
+				g.cells[c] = make(map[rtreego.Spatial]struct{})
+			}
+			g.cells[c][obj] = struct{}{}
+			cells = append(cells, c)
+		}
+	}
+	g.objects[obj] = cells
+}
+
+// Delete implements Index
+func (g *Grid) Delete(obj rtreego.Spatial) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	cells, found := g.objects[obj]
+	if !found {
+		return false
+	}
+	for _, c := range cells {
+		delete(g.cells[c], obj)
+		if len(g.cells[c]) == 0 {
+			delete(g.cells, c)
+		}
+	}
+	delete(g.large, obj)
+	delete(g.objects, obj)
+	return true
+}
+
+// SearchIntersect implements Index
+func (g *Grid) SearchIntersect(bb *rtreego.Rect, filters ...rtreego.Filter) []rtreego.Spatial {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	seen := make(map[rtreego.Spatial]struct{})
+	candidates := make([]rtreego.Spatial, 0)
+	collect := func(objs map[rtreego.Spatial]struct{}) {
+		for obj := range objs {
+			if _, found := seen[obj]; !found {
+				seen[obj] = struct{}{}
+				candidates = append(candidates, obj)
+			}
+		}
+	}
+
+	collect(g.large)
+	lo, hi := g.cellRange(bb)
+	if cellCount(lo, hi) > float64(len(g.cells)) {
+		// the area is larger than the populated part of the grid
+		for c, objs := range g.cells {
+			if c.x >= lo.x && c.x <= hi.x && c.y >= lo.y && c.y <= hi.y {
+				collect(objs)
+			}
+		}
+	} else {
+		for x := lo.x; x <= hi.x; x++ {
+			for y := lo.y; y <= hi.y; y++ {
+				collect(g.cells[gridCell{x, y}])
+			}
+		}
+	}
+
+	return search(candidates, bb, filters)
+}
+
+// Nearest implements Index. The grid has no hierarchy to prune the search with,
+// so all the objects are sorted by distance
+func (g *Grid) Nearest(p rtreego.Point, k int, filters ...rtreego.Filter) []rtreego.Spatial {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	candidates := make([]rtreego.Spatial, 0, len(g.objects))
+	for obj := range g.objects {
+		candidates = append(candidates, obj)
+	}
+	return nearest(candidates, p, k, filters)
+}
+
+// Len implements Index
+func (g *Grid) Len() int {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	return len(g.objects)
+}
+
+// BulkLoad implements BulkLoader. The new grid is filled in
+// while the current one is still available for searches
+func (g *Grid) BulkLoad(objs []rtreego.Spatial) {
+	fresh := NewGrid(g.cellSize)
+	for _, obj := range objs {
+		fresh.Insert(obj)
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.cells = fresh.cells
+	g.objects = fresh.objects
+	g.large = fresh.large
+}
@@ -0,0 +1,81 @@
+// Package index provides spatial index implementations for spatial.Server
+package index
+
+import (
+	"sort"
+
+	"github.com/dhconnelly/rtreego"
+	"github.com/viert/spatial/internal/rtreeutil"
+)
+
+// Index is a thread-safe two-dimensional spatial index.
+// Objects are compared by identity, so the same value
+// that was inserted should be used to delete it
+type Index interface {
+	// Insert adds an object to the index
+	Insert(obj rtreego.Spatial)
+	// Delete removes an object from the index, returns false if it wasn't found
+	Delete(obj rtreego.Spatial) bool
+	// SearchIntersect returns objects intersecting with bb and passing filters
+	SearchIntersect(bb *rtreego.Rect, filters ...rtreego.Filter) []rtreego.Spatial
+	// Nearest returns up to k objects closest to p passing filters, nearest first
+	Nearest(p rtreego.Point, k int, filters ...rtreego.Filter) []rtreego.Spatial
+	// Len returns the number of objects in the index
+	Len() int
+}
+
+// Depther is implemented by tree-like indexes able to report their depth
+type Depther interface {
+	Depth() int
+}
+
+// BulkLoader is implemented by indexes able to build themselves out of
+// a large number of objects faster than inserting them one by one
+type BulkLoader interface {
+	// BulkLoad replaces all the objects in the index with objs
+	BulkLoad(objs []rtreego.Spatial)
+}
+
+// search collects candidates intersecting with bb and passing filters
+func search(candidates []rtreego.Spatial, bb *rtreego.Rect, filters []rtreego.Filter) []rtreego.Spatial {
+	results := make([]rtreego.Spatial, 0)
+	for _, obj := range candidates {
+		if !rtreeutil.Intersects(obj.Bounds(), bb) {
+			continue
+		}
+		refuse, abort := rtreeutil.ApplyFilters(results, obj, filters)
+		if !refuse {
+			results = append(results, obj)
+		}
+		if abort {
+			break
+		}
+	}
+	return results
+}
+
+// nearest picks up to k candidates closest to p by sorting all of them
+func nearest(candidates []rtreego.Spatial, p rtreego.Point, k int, filters []rtreego.Filter) []rtreego.Spatial {
+	dists := make(map[rtreego.Spatial]float64, len(candidates))
+	for _, obj := range candidates {
+		dists[obj] = rtreeutil.MinDist(p, obj.Bounds())
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return dists[candidates[i]] < dists[candidates[j]]
+	})
+
+	results := make([]rtreego.Spatial, 0, k)
+	for _, obj := range candidates {
+		if len(results) >= k {
+			break
+		}
+		refuse, abort := rtreeutil.ApplyFilters(results, obj, filters)
+		if !refuse {
+			results = append(results, obj)
+		}
+		if abort {
+			break
+		}
+	}
+	return results
+}
@@ -0,0 +1,269 @@
+package index
+
+import (
+	"math/rand"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dhconnelly/rtreego"
+	"github.com/viert/spatial/internal/rtreeutil"
+	"github.com/viert/spatial/rtree"
+)
+
+type item struct {
+	id   int
+	rect *rtreego.Rect
+}
+
+func (it *item) Bounds() *rtreego.Rect {
+	return it.rect
+}
+
+// plainIndex hides optional interfaces of the wrapped index
+type plainIndex struct {
+	Index
+}
+
+var (
+	worldRect, _ = rtreego.NewRect(rtreego.Point{-90, -180}, []float64{180, 360})
+
+	implementations = map[string]func() Index{
+		"rtree":    func() Index { return rtree.New(2, 25, 50) },
+		"grid":     func() Index { return NewGrid(1) },
+		"quadtree": func() Index { return NewQuadtree(worldRect, 8, 16) },
+		"geohash":  func() Index { return NewGeohash(6) },
+		"cow":      func() Index { return NewCOW(25, 50, 64) },
+		"sharded": func() Index {
+			return NewSharded(4, 8, func() Index { return rtree.New(2, 25, 50) })
+		},
+		"sharded-plain": func() Index {
+			return NewSharded(4, 8, func() Index { return plainIndex{rtree.New(2, 25, 50)} })
+		},
+	}
+)
+
+func randomRect(rnd *rand.Rand, maxSize float64) *rtreego.Rect {
+	lat := rnd.Float64()*170 - 85
+	lng := rnd.Float64()*350 - 175
+	rect, _ := rtreego.NewRect(
+		rtreego.Point{lat, lng},
+		[]float64{0.001 + rnd.Float64()*maxSize, 0.001 + rnd.Float64()*maxSize},
+	)
+	return rect
+}
+
+func randomItems(rnd *rand.Rand, n int) []*item {
+	items := make([]*item, n)
+	for i := range items {
+		size := 0.1
+		if i%20 == 0 {
+			// a few large polygons
+			size = 30
+		}
+		items[i] = &item{i, randomRect(rnd, size)}
+	}
+	return items
+}
+
+func ids(spatials []rtreego.Spatial) []int {
+	res := make([]int, len(spatials))
+	for i, sp := range spatials {
+		res[i] = sp.(*item).id
+	}
+	sort.Ints(res)
+	return res
+}
+
+func sameIDs(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func bruteForce(items map[*item]bool, bb *rtreego.Rect) []int {
+	res := make([]int, 0)
+	for it := range items {
+		if rtreeutil.Intersects(it.rect, bb) {
+			res = append(res, it.id)
+		}
+	}
+	sort.Ints(res)
+	return res
+}
+
+func filterEven(results []rtreego.Spatial, obj rtreego.Spatial) (bool, bool) {
+	return obj.(*item).id%2 != 0, false
+}
+
+func testConformance(t *testing.T, idx Index, bulk bool) {
+	rnd := rand.New(rand.NewSource(1))
+	items := randomItems(rnd, 2000)
+	present := make(map[*item]bool)
+
+	loaded := 0
+	if bulk {
+		// bulk loading replaces everything inserted before
+		for _, it := range randomItems(rnd, 100) {
+			idx.Insert(it)
+		}
+		loaded = len(items) / 2
+		spatials := make([]rtreego.Spatial, loaded)
+		for i, it := range items[:loaded] {
+			spatials[i] = it
+			present[it] = true
+		}
+		idx.(BulkLoader).BulkLoad(spatials)
+	}
+	for _, it := range items[loaded:] {
+		idx.Insert(it)
+		present[it] = true
+	}
+	if idx.Len() != len(items) {
+		t.Errorf("expected %d objects, got %d", len(items), idx.Len())
+	}
+
+	check := func() {
+		for i := 0; i < 100; i++ {
+			bb := randomRect(rnd, 20)
+			expected := bruteForce(present, bb)
+			if got := ids(idx.SearchIntersect(bb)); !sameIDs(got, expected) {
+				t.Errorf("search %s: expected %v, got %v", bb, expected, got)
+				return
+			}
+		}
+	}
+	check()
+
+	for i, it := range items {
+		if i%2 == 0 {
+			if !idx.Delete(it) {
+				t.Errorf("object %d is expected to be deleted", it.id)
+			}
+			delete(present, it)
+		}
+	}
+	if idx.Delete(items[0]) {
+		t.Errorf("object %d is expected to be deleted already", items[0].id)
+	}
+	if idx.Len() != len(present) {
+		t.Errorf("expected %d objects, got %d", len(present), idx.Len())
+	}
+	check()
+
+	// the remaining objects are odd, so nothing should pass the filter
+	if res := idx.SearchIntersect(worldRect, filterEven); len(res) != 0 {
+		t.Errorf("expected no objects to pass the filter, got %d", len(res))
+	}
+	if res := idx.SearchIntersect(worldRect, rtreego.LimitFilter(10)); len(res) != 10 {
+		t.Errorf("expected 10 objects with a limit filter, got %d", len(res))
+	}
+
+	p := rtreego.Point{10, 20}
+	candidates := make([]rtreego.Spatial, 0)
+	for it := range present {
+		candidates = append(candidates, it)
+	}
+	expected := ids(nearest(candidates, p, 5, nil))
+	if got := ids(idx.Nearest(p, 5)); !sameIDs(got, expected) {
+		t.Errorf("nearest: expected %v, got %v", expected, got)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	for name, factory := range implementations {
+		t.Run(name, func(t *testing.T) {
+			testConformance(t, factory(), false)
+		})
+	}
+}
+
+func TestBulkLoadConformance(t *testing.T) {
+	for name, factory := range implementations {
+		t.Run(name, func(t *testing.T) {
+			testConformance(t, factory(), true)
+		})
+	}
+}
+
+// benchmarkConcurrent runs a mix of writers moving objects around
+// and readers searching areas comparable to a map viewport
+func benchmarkConcurrent(b *testing.B, idx Index) {
+	rnd := rand.New(rand.NewSource(1))
+	items := randomItems(rnd, 50000)
+	for _, it := range items {
+		idx.Insert(it)
+	}
+
+	var seq int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		n := atomic.AddInt64(&seq, 1)
+		rnd := rand.New(rand.NewSource(n))
+		for pb.Next() {
+			if rnd.Intn(4) == 0 {
+				idx.SearchIntersect(randomRect(rnd, 10))
+			} else {
+				it := items[rnd.Intn(len(items))]
+				if idx.Delete(it) {
+					idx.Insert(it)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkConcurrentRtree(b *testing.B) {
+	benchmarkConcurrent(b, rtree.New(2, 25, 50))
+}
+
+func BenchmarkConcurrentSharded(b *testing.B) {
+	benchmarkConcurrent(b, NewSharded(8, 16, func() Index { return rtree.New(2, 25, 50) }))
+}
+
+func BenchmarkConcurrentCOW(b *testing.B) {
+	benchmarkConcurrent(b, NewCOW(25, 50, 1024))
+}
+
+func TestCOWSnapshot(t *testing.T) {
+	idx := NewCOW(25, 50, 4)
+	rnd := rand.New(rand.NewSource(1))
+	items := randomItems(rnd, 10)
+	for _, it := range items[:5] {
+		idx.Insert(it)
+	}
+
+	snapshot := idx.Snapshot()
+	idx.Batch([]rtreego.Spatial{items[0]}, []rtreego.Spatial{items[5], items[6]})
+
+	if snapshot.Len() != 5 || len(snapshot.SearchIntersect(worldRect)) != 5 {
+		t.Errorf("snapshot is expected to keep 5 objects")
+	}
+	if idx.Len() != 6 || len(idx.SearchIntersect(worldRect)) != 6 {
+		t.Errorf("index is expected to have 6 objects")
+	}
+}
+
+func TestOutsideWorld(t *testing.T) {
+	beyond, _ := rtreego.NewRect(rtreego.Point{10, 200}, []float64{1, 1})
+	huge, _ := rtreego.NewRect(rtreego.Point{-1e300, -1e300}, []float64{1e300, 1e300})
+	for name, factory := range implementations {
+		t.Run(name, func(t *testing.T) {
+			idx := factory()
+			idx.Insert(&item{id: 1, rect: beyond})
+			idx.Insert(&item{id: 2, rect: huge})
+			if got := ids(idx.SearchIntersect(beyond)); !sameIDs(got, []int{1}) {
+				t.Errorf("expected the object beyond the antimeridian to be found, got %v", got)
+			}
+			if got := ids(idx.SearchIntersect(huge)); !sameIDs(got, []int{2}) {
+				t.Errorf("expected the huge object to be found, got %v", got)
+			}
+		})
+	}
+}
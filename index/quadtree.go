@@ -0,0 +1,212 @@
+package index
+
+import (
+	"sync"
+
+	"github.com/dhconnelly/rtreego"
+)
+
+type quadNode struct {
+	lo       [2]float64
+	hi       [2]float64
+	depth    int
+	items    map[rtreego.Spatial]struct{}
+	children []*quadNode
+}
+
+func newQuadNode(lo [2]float64, hi [2]float64, depth int) *quadNode {
+	return &quadNode{
+		lo:    lo,
+		hi:    hi,
+		depth: depth,
+		items: make(map[rtreego.Spatial]struct{}),
+	}
+}
+
+func (n *quadNode) contains(r *rtreego.Rect) bool {
+	for i := 0; i < 2; i++ {
+		if r.PointCoord(i) < n.lo[i] || r.PointCoord(i)+r.LengthsCoord(i) > n.hi[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *quadNode) intersects(r *rtreego.Rect) bool {
+	for i := 0; i < 2; i++ {
+		if r.PointCoord(i)+r.LengthsCoord(i) < n.lo[i] || r.PointCoord(i) > n.hi[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// childFor returns a child node fully containing a rect, if any
+func (n *quadNode) childFor(r *rtreego.Rect) *quadNode {
+	for _, child := range n.children {
+		if child.contains(r) {
+			return child
+		}
+	}
+	return nil
+}
+
+func (n *quadNode) split() {
+	mid := [2]float64{(n.lo[0] + n.hi[0]) / 2, (n.lo[1] + n.hi[1]) / 2}
+	n.children = []*quadNode{
+		newQuadNode([2]float64{n.lo[0], n.lo[1]}, [2]float64{mid[0], mid[1]}, n.depth+1),
+		newQuadNode([2]float64{n.lo[0], mid[1]}, [2]float64{mid[0], n.hi[1]}, n.depth+1),
+		newQuadNode([2]float64{mid[0], n.lo[1]}, [2]float64{n.hi[0], mid[1]}, n.depth+1),
+		newQuadNode([2]float64{mid[0], mid[1]}, [2]float64{n.hi[0], n.hi[1]}, n.depth+1),
+	}
+}
+
+// Quadtree is a region quadtree index. Objects are kept in the deepest node
+// fully containing them, which makes it suitable for objects of very
+// different sizes including large polygons
+type Quadtree struct {
+	lock     sync.RWMutex
+	root     *quadNode
+	maxItems int
+	maxDepth int
+	where    map[rtreego.Spatial]*quadNode
+}
+
+// NewQuadtree creates a new Quadtree covering given bounds. A node is split
+// when it has more than maxItems objects unless it's maxDepth deep already.
+// Objects outside of the bounds are kept in the root node
+func NewQuadtree(bounds *rtreego.Rect, maxItems int, maxDepth int) *Quadtree {
+	lo := [2]float64{bounds.PointCoord(0), bounds.PointCoord(1)}
+	hi := [2]float64{lo[0] + bounds.LengthsCoord(0), lo[1] + bounds.LengthsCoord(1)}
+	return &Quadtree{
+		root:     newQuadNode(lo, hi, 1),
+		maxItems: maxItems,
+		maxDepth: maxDepth,
+		where:    make(map[rtreego.Spatial]*quadNode),
+	}
+}
+
+func (q *Quadtree) insert(n *quadNode, obj rtreego.Spatial) {
+	for {
+		child := n.childFor(obj.Bounds())
+		if child == nil {
+			break
+		}
+		n = child
+	}
+
+	n.items[obj] = struct{}{}
+	q.where[obj] = n
+
+	if n.children == nil && len(n.items) > q.maxItems && n.depth < q.maxDepth {
+		n.split()
+		for item := range n.items {
+			if child := n.childFor(item.Bounds()); child != nil {
+				delete(n.items, item)
+				q.insert(child, item)
+			}
+		}
+	}
+}
+
+// Insert implements Index
+func (q *Quadtree) Insert(obj rtreego.Spatial) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.insert(q.root, obj)
+}
+
+// Delete implements Index
+func (q *Quadtree) Delete(obj rtreego.Spatial) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	n, found := q.where[obj]
+	if !found {
+		return false
+	}
+	delete(n.items, obj)
+	delete(q.where, obj)
+	return true
+}
+
+func (q *Quadtree) collect(n *quadNode, bb *rtreego.Rect, candidates []rtreego.Spatial) []rtreego.Spatial {
+	for item := range n.items {
+		candidates = append(candidates, item)
+	}
+	for _, child := range n.children {
+		if child.intersects(bb) {
+			candidates = q.collect(child, bb, candidates)
+		}
+	}
+	return candidates
+}
+
+// SearchIntersect implements Index
+func (q *Quadtree) SearchIntersect(bb *rtreego.Rect, filters ...rtreego.Filter) []rtreego.Spatial {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	// the root is always visited as it holds the objects out of its bounds
+	candidates := q.collect(q.root, bb, make([]rtreego.Spatial, 0))
+	return search(candidates, bb, filters)
+}
+
+// Nearest implements Index. Objects are kept in nodes larger than themselves,
+// so all of them are sorted by distance
+func (q *Quadtree) Nearest(p rtreego.Point, k int, filters ...rtreego.Filter) []rtreego.Spatial {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+
+	candidates := make([]rtreego.Spatial, 0, len(q.where))
+	for obj := range q.where {
+		candidates = append(candidates, obj)
+	}
+	return nearest(candidates, p, k, filters)
+}
+
+// Len implements Index
+func (q *Quadtree) Len() int {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	return len(q.where)
+}
+
+func (n *quadNode) maxDepth() int {
+	depth := n.depth
+	for _, child := range n.children {
+		if d := child.maxDepth(); d > depth {
+			depth = d
+		}
+	}
+	return depth
+}
+
+// Depth implements Depther
+func (q *Quadtree) Depth() int {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	return q.root.maxDepth()
+}
+
+// BulkLoad implements BulkLoader. The new tree is built
+// while the current one is still available for searches
+func (q *Quadtree) BulkLoad(objs []rtreego.Spatial) {
+	q.lock.RLock()
+	lo, hi := q.root.lo, q.root.hi
+	q.lock.RUnlock()
+
+	fresh := &Quadtree{
+		root:     newQuadNode(lo, hi, 1),
+		maxItems: q.maxItems,
+		maxDepth: q.maxDepth,
+		where:    make(map[rtreego.Spatial]*quadNode, len(objs)),
+	}
+	for _, obj := range objs {
+		fresh.insert(fresh.root, obj)
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.root = fresh.root
+	q.where = fresh.where
+}
@@ -0,0 +1,200 @@
+package index
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dhconnelly/rtreego"
+	"github.com/viert/spatial/internal/rtreeutil"
+)
+
+// Sharded partitions the world into latitude/longitude stripes, each backed
+// by its own index with its own lock, so writers in different parts of the
+// world don't contend. Objects crossing stripe borders are put into all
+// the shards they touch, searches are fanned out across the touched shards.
+// Bounds of an object must not change while it's in the index
+type Sharded struct {
+	lo         [2]float64
+	size       [2]float64
+	latStripes int
+	lngStripes int
+	shards     []Index
+	count      int64
+}
+
+// NewSharded creates a new Sharded index of latStripes x lngStripes shards
+// covering the world, shards are created by factory
+func NewSharded(latStripes int, lngStripes int, factory func() Index) *Sharded {
+	s := &Sharded{
+		lo:         [2]float64{-90, -180},
+		size:       [2]float64{180 / float64(latStripes), 360 / float64(lngStripes)},
+		latStripes: latStripes,
+		lngStripes: lngStripes,
+		shards:     make([]Index, latStripes*lngStripes),
+	}
+	for i := range s.shards {
+		s.shards[i] = factory()
+	}
+	return s
+}
+
+func (s *Sharded) stripe(dim int, v float64, stripes int) int {
+	i := int(math.Floor((v - s.lo[dim]) / s.size[dim]))
+	if i < 0 {
+		return 0
+	}
+	if i >= stripes {
+		return stripes - 1
+	}
+	return i
+}
+
+// shardsFor returns indexes of the shards a rect touches
+func (s *Sharded) shardsFor(r *rtreego.Rect) []int {
+	lat0 := s.stripe(0, r.PointCoord(0), s.latStripes)
+	lat1 := s.stripe(0, r.PointCoord(0)+r.LengthsCoord(0), s.latStripes)
+	lng0 := s.stripe(1, r.PointCoord(1), s.lngStripes)
+	lng1 := s.stripe(1, r.PointCoord(1)+r.LengthsCoord(1), s.lngStripes)
+
+	shards := make([]int, 0, (lat1-lat0+1)*(lng1-lng0+1))
+	for lat := lat0; lat <= lat1; lat++ {
+		for lng := lng0; lng <= lng1; lng++ {
+			shards = append(shards, lat*s.lngStripes+lng)
+		}
+	}
+	return shards
+}
+
+// Insert implements Index
+func (s *Sharded) Insert(obj rtreego.Spatial) {
+	for _, i := range s.shardsFor(obj.Bounds()) {
+		s.shards[i].Insert(obj)
+	}
+	atomic.AddInt64(&s.count, 1)
+}
+
+// Delete implements Index
+func (s *Sharded) Delete(obj rtreego.Spatial) bool {
+	deleted := false
+	for _, i := range s.shardsFor(obj.Bounds()) {
+		if s.shards[i].Delete(obj) {
+			deleted = true
+		}
+	}
+	if deleted {
+		atomic.AddInt64(&s.count, -1)
+	}
+	return deleted
+}
+
+// fanOut runs fn for every shard in parallel and merges deduplicated results
+func (s *Sharded) fanOut(shards []int, fn func(Index) []rtreego.Spatial) []rtreego.Spatial {
+	if len(shards) == 1 {
+		return fn(s.shards[shards[0]])
+	}
+
+	parts := make([][]rtreego.Spatial, len(shards))
+	var wg sync.WaitGroup
+	wg.Add(len(shards))
+	for n, i := range shards {
+		go func(n int, shard Index) {
+			defer wg.Done()
+			parts[n] = fn(shard)
+		}(n, s.shards[i])
+	}
+	wg.Wait()
+
+	seen := make(map[rtreego.Spatial]struct{})
+	merged := make([]rtreego.Spatial, 0)
+	for _, part := range parts {
+		for _, obj := range part {
+			if _, found := seen[obj]; !found {
+				seen[obj] = struct{}{}
+				merged = append(merged, obj)
+			}
+		}
+	}
+	return merged
+}
+
+// SearchIntersect implements Index. When the search spans multiple shards
+// filters are applied to the merged results
+func (s *Sharded) SearchIntersect(bb *rtreego.Rect, filters ...rtreego.Filter) []rtreego.Spatial {
+	shards := s.shardsFor(bb)
+	if len(shards) == 1 {
+		return s.shards[shards[0]].SearchIntersect(bb, filters...)
+	}
+
+	merged := s.fanOut(shards, func(shard Index) []rtreego.Spatial {
+		return shard.SearchIntersect(bb)
+	})
+	return search(merged, bb, filters)
+}
+
+// Nearest implements Index. Every shard is asked for k nearest objects,
+// filters are expected to refuse objects independently of the results
+func (s *Sharded) Nearest(p rtreego.Point, k int, filters ...rtreego.Filter) []rtreego.Spatial {
+	shards := make([]int, len(s.shards))
+	for i := range shards {
+		shards[i] = i
+	}
+	merged := s.fanOut(shards, func(shard Index) []rtreego.Spatial {
+		return shard.Nearest(p, k, filters...)
+	})
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return rtreeutil.MinDist(p, merged[i].Bounds()) < rtreeutil.MinDist(p, merged[j].Bounds())
+	})
+	if len(merged) > k {
+		merged = merged[:k]
+	}
+	return merged
+}
+
+// Len implements Index
+func (s *Sharded) Len() int {
+	return int(atomic.LoadInt64(&s.count))
+}
+
+// BulkLoad implements BulkLoader, shards are loaded in parallel.
+// Shards not implementing BulkLoader are cleared and filled one by one
+func (s *Sharded) BulkLoad(objs []rtreego.Spatial) {
+	parts := make([][]rtreego.Spatial, len(s.shards))
+	for _, obj := range objs {
+		for _, i := range s.shardsFor(obj.Bounds()) {
+			parts[i] = append(parts[i], obj)
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(s.shards))
+	for i, shard := range s.shards {
+		go func(shard Index, part []rtreego.Spatial) {
+			defer wg.Done()
+			if loader, ok := shard.(BulkLoader); ok {
+				loader.BulkLoad(part)
+				return
+			}
+			for _, obj := range shard.SearchIntersect(s.bounds()) {
+				shard.Delete(obj)
+			}
+			for _, obj := range part {
+				shard.Insert(obj)
+			}
+		}(shard, parts[i])
+	}
+	wg.Wait()
+	atomic.StoreInt64(&s.count, int64(len(objs)))
+}
+
+// bounds returns a rect covering everything the index may contain,
+// objects beyond the world are put into the edge shards
+func (s *Sharded) bounds() *rtreego.Rect {
+	r, _ := rtreego.NewRect(
+		rtreego.Point{-math.MaxFloat64 / 4, -math.MaxFloat64 / 4},
+		[]float64{math.MaxFloat64 / 2, math.MaxFloat64 / 2},
+	)
+	return r
+}
@@ -1,6 +1,10 @@
 package spatial
 
-import "github.com/dhconnelly/rtreego"
+import (
+	"sync"
+
+	"github.com/dhconnelly/rtreego"
+)
 
 // IndexableType is a type for enums describing types of objects in index tree.
 // Negative numbers are reserved for internal use
@@ -24,7 +28,12 @@ type Object struct {
 	ref     interface{}
 	bounds  *rtreego.Rect
 	meta    map[string]string
+	attrs   map[string]Attr
+	parent  string
 	objType IndexableType
+	// meta and attrs may be modified in place by Server.UpdateMeta
+	// and Server.UpdateAttrs
+	metaLock sync.RWMutex
 }
 
 // ID implements Indexable
@@ -49,16 +58,74 @@ func (o *Object) Type() IndexableType {
 
 // Meta is Object meta getter
 func (o *Object) Meta(key string) string {
+	o.metaLock.RLock()
+	defer o.metaLock.RUnlock()
 	return o.meta[key]
 }
 
 // HasMetaKey is Object meta key checker
 func (o *Object) HasMetaKey(key string) bool {
+	o.metaLock.RLock()
+	defer o.metaLock.RUnlock()
 	_, found := o.meta[key]
 	return found
 }
 
-// NewObject creates a new instance of Object
+// MetaMap returns a copy of Object meta
+func (o *Object) MetaMap() map[string]string {
+	o.metaLock.RLock()
+	defer o.metaLock.RUnlock()
+	meta := make(map[string]string, len(o.meta))
+	for key, value := range o.meta {
+		meta[key] = value
+	}
+	return meta
+}
+
+// Attr implements Attributed
+func (o *Object) Attr(key string) (Attr, bool) {
+	o.metaLock.RLock()
+	defer o.metaLock.RUnlock()
+	attr, found := o.attrs[key]
+	return attr, found
+}
+
+// Attrs returns a copy of Object attributes
+func (o *Object) Attrs() map[string]Attr {
+	o.metaLock.RLock()
+	defer o.metaLock.RUnlock()
+	attrs := make(map[string]Attr, len(o.attrs))
+	for key, attr := range o.attrs {
+		attrs[key] = attr
+	}
+	return attrs
+}
+
+// ParentID implements Child
+func (o *Object) ParentID() string {
+	return o.parent
+}
+
+// WithParent makes Object a member of a group with a given id and returns
+// the object, it's meant to be used right after NewObject
+func (o *Object) WithParent(id string) *Object {
+	o.parent = id
+	return o
+}
+
+// WithAttrs sets Object attributes and returns the object, it's meant to be used
+// right after NewObject. Use Server.UpdateAttrs for objects in the index
+func (o *Object) WithAttrs(attrs map[string]Attr) *Object {
+	o.metaLock.Lock()
+	defer o.metaLock.Unlock()
+	for key, attr := range attrs {
+		o.attrs[key] = attr
+	}
+	return o
+}
+
+// NewObject creates a new instance of Object, longitudes of bounds
+// outside of [-180, 180] are normalized
 func NewObject(id string, objType IndexableType, bounds *rtreego.Rect, ref interface{}, meta map[string]string) *Object {
 	if meta == nil {
 		meta = make(map[string]string)
@@ -67,8 +134,9 @@ func NewObject(id string, objType IndexableType, bounds *rtreego.Rect, ref inter
 	return &Object{
 		id:      id,
 		objType: objType,
-		bounds:  bounds,
+		bounds:  NormalizeRect(bounds),
 		ref:     ref,
 		meta:    meta,
+		attrs:   make(map[string]Attr),
 	}
 }
@@ -0,0 +1,46 @@
+// Package rtreeutil holds helpers reproducing rtreego semantics
+// for indexes and searches not backed by rtreego
+package rtreeutil
+
+import (
+	"github.com/dhconnelly/rtreego"
+)
+
+// ApplyFilters mimics rtreego filtering: filters are applied in order
+// until one of them refuses the object or aborts the search
+func ApplyFilters(results []rtreego.Spatial, obj rtreego.Spatial, filters []rtreego.Filter) (bool, bool) {
+	for _, filter := range filters {
+		refuse, abort := filter(results, obj)
+		if refuse || abort {
+			return refuse, abort
+		}
+	}
+	return false, false
+}
+
+// Intersects follows rtreego semantics, rects touching each other don't intersect
+func Intersects(a *rtreego.Rect, b *rtreego.Rect) bool {
+	for i := 0; i < 2; i++ {
+		a1, b1 := a.PointCoord(i), a.PointCoord(i)+a.LengthsCoord(i)
+		a2, b2 := b.PointCoord(i), b.PointCoord(i)+b.LengthsCoord(i)
+		if b2 <= a1 || b1 <= a2 {
+			return false
+		}
+	}
+	return true
+}
+
+// MinDist computes the square of the distance from a point to a rect
+// the same way rtreego does
+func MinDist(p rtreego.Point, r *rtreego.Rect) float64 {
+	sum := 0.0
+	for i := range p {
+		lo, hi := r.PointCoord(i), r.PointCoord(i)+r.LengthsCoord(i)
+		if p[i] < lo {
+			sum += (p[i] - lo) * (p[i] - lo)
+		} else if p[i] > hi {
+			sum += (p[i] - hi) * (p[i] - hi)
+		}
+	}
+	return sum
+}
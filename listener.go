@@ -1,45 +1,117 @@
 package spatial
 
 import (
+	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dhconnelly/rtreego"
+	"github.com/viert/spatial/helper"
 )
 
 // Listener is an object watching for objects in bounding boxes and with specific ids
 // and sends updates through a channel
 type Listener struct {
+	seq            uint64
 	lock           sync.RWMutex
 	srv            *Server
 	ch             chan []Indexable
-	boxes          []*boundingBox
+	areas          map[BoundsHandle]*area
+	lastHandle     BoundsHandle
 	filter         rtreego.Filter
+	types          []IndexableType
 	watchIds       map[string]bool
 	updateInterval time.Duration
-	dirty          bool
-	stopped        bool
+	dirty          int32
+	predict        bool
+	groupMode      GroupMode
+	followID       string
+	followRadius   float64
+	followHandle   BoundsHandle
+	// stopped makes areas added concurrently with Stop get disposed
+	stopped bool
+
+	backpressure      BackpressurePolicy
+	disconnectTimeout time.Duration
+	dropped           uint64
+	err               error
+	ctx               context.Context
+	done              chan struct{}
+	stopOnce          sync.Once
+	chLock            sync.RWMutex
+
+	// sink replaces the update channel, e.g. for typed listeners
+	sink      func(l *Listener, objects []Indexable) error
+	closeSink func()
+
+	callback     func([]Indexable)
+	cbLock       sync.Mutex
+	cbPending    []Indexable
+	cbHasPending bool
+	cbScheduled  bool
+	panics       uint64
+
+	// scheduling state, guarded by the server scheduler lock
+	queued       bool
+	dueAt        time.Time
+	lastDelivery time.Time
+	flushing     int32
+
+	updatesSent uint64
+	objectsSent uint64
+	dirtyMarks  uint64
+	lastSent    int64
+	dirtySince  int64
+}
+
+// BoundsHandle identifies an area a listener listens to
+type BoundsHandle uint64
+
+// area is a MapBounds indexed as one or more bounding boxes
+type area struct {
+	bounds MapBounds
+	boxes  []*boundingBox
+}
+
+func (a *area) dispose(srv *Server) {
+	for _, box := range a.boxes {
+		srv.tree.Delete(box)
+	}
 }
 
-func newListener(srv *Server, chSize int, interval time.Duration) *Listener {
+func newListener(srv *Server, chSize int, interval time.Duration, opts ...ListenerOption) *Listener {
 	lstr := &Listener{
+		seq:            atomic.AddUint64(&listenerAutoID, 1),
 		srv:            srv,
 		ch:             make(chan []Indexable, chSize),
-		boxes:          make([]*boundingBox, 0),
+		areas:          make(map[BoundsHandle]*area),
 		filter:         nil,
 		watchIds:       make(map[string]bool),
 		updateInterval: interval,
-		stopped:        false,
-		dirty:          false,
+
+		backpressure:      BackpressureBlock,
+		disconnectTimeout: DefaultDisconnectTimeout,
+		done:              make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(lstr)
+	}
+	srv.register(lstr)
+	if lstr.ctx != nil {
+		go lstr.watchContext()
 	}
-	go lstr.loop()
 	return lstr
 }
 
 func (l *Listener) disposeBoxes() {
-	// No locking here as l.boxes is always overwritten and never changed
-	for _, box := range l.boxes {
-		l.srv.tree.Delete(box)
+	l.lock.Lock()
+	areas := l.areas
+	l.areas = make(map[BoundsHandle]*area)
+	l.lock.Unlock()
+
+	for _, a := range areas {
+		a.dispose(l.srv)
 	}
 }
 
@@ -53,35 +125,201 @@ func (l *Listener) unsubscribeAll() {
 	}
 }
 
-// SetBounds sets bounds to listen to
-func (l *Listener) SetBounds(mb MapBounds) {
-	l.disposeBoxes()
+// boxes returns bounding boxes of all the listener's areas
+func (l *Listener) boxes() []*boundingBox {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	boxes := make([]*boundingBox, 0, len(l.areas))
+	for _, a := range l.areas {
+		boxes = append(boxes, a.boxes...)
+	}
+	return boxes
+}
 
+func (l *Listener) makeArea(mb MapBounds) *area {
 	rects := mb.Rects()
-	boxes := make([]*boundingBox, len(rects))
+	a := &area{
+		bounds: mb,
+		boxes:  make([]*boundingBox, len(rects)),
+	}
 	for i, rect := range rects {
 		box := newBoundingBox(rect, l)
 		l.srv.tree.Insert(box)
-		boxes[i] = box
+		a.boxes[i] = box
 	}
-	l.boxes = boxes
+	return a
+}
+
+// SetBounds sets bounds to listen to replacing all the previously set ones
+func (l *Listener) SetBounds(mb MapBounds) BoundsHandle {
+	return l.SetBoundsMulti([]MapBounds{mb})[0]
+}
+
+// SetBoundsMulti sets multiple areas to listen to replacing all the previously
+// set ones. Returns handles of the areas in the same order
+func (l *Listener) SetBoundsMulti(mbs []MapBounds) []BoundsHandle {
+	l.disposeBoxes()
+	handles := make([]BoundsHandle, len(mbs))
+	for i, mb := range mbs {
+		handles[i] = l.AddBounds(mb)
+	}
+	l.setDirty()
+	return handles
+}
+
+// AddBounds adds an area to listen to keeping the previously set ones.
+// Objects found in multiple areas are sent once. Stopped listeners
+// ignore new areas returning zero handles
+func (l *Listener) AddBounds(mb MapBounds) BoundsHandle {
+	a := l.makeArea(mb)
+
+	l.lock.Lock()
+	if l.stopped {
+		l.lock.Unlock()
+		a.dispose(l.srv)
+		return 0
+	}
+	l.lastHandle++
+	handle := l.lastHandle
+	l.areas[handle] = a
+	l.lock.Unlock()
+	l.setDirty()
+	return handle
+}
+
+// RemoveBounds removes an area by its handle. Returns false
+// if there's no such area
+func (l *Listener) RemoveBounds(handle BoundsHandle) bool {
+	l.lock.Lock()
+	a, found := l.areas[handle]
+	delete(l.areas, handle)
+	l.lock.Unlock()
+
+	if found {
+		a.dispose(l.srv)
+		l.setDirty()
+	}
+	return found
+}
+
+// replaceBounds replaces an area keeping its handle, adds
+// a new area if there's no area with such handle
+func (l *Listener) replaceBounds(handle BoundsHandle, mb MapBounds) BoundsHandle {
+	a := l.makeArea(mb)
+
+	l.lock.Lock()
+	if l.stopped {
+		l.lock.Unlock()
+		a.dispose(l.srv)
+		return handle
+	}
+	prev, found := l.areas[handle]
+	if !found {
+		l.lastHandle++
+		handle = l.lastHandle
+	}
+	l.areas[handle] = a
+	l.lock.Unlock()
+
+	if found {
+		prev.dispose(l.srv)
+	}
+	return handle
 }
 
 // SetTypes sets a filter to listen for objects of specified types only
 // Does not apply for ID subscriptions
 func (l *Listener) SetTypes(types []IndexableType) {
+	l.lock.Lock()
+	l.types = types
 	if len(types) == 0 {
 		l.filter = nil
 	} else {
 		l.filter = FilterByTypes(types)
 	}
+	l.lock.Unlock()
+	l.setDirty()
+}
+
+// SetPrediction turns on and off extrapolation of Moving objects' positions.
+// Predicted listeners send updates on every tick as positions change
+// continuously, Moving objects are sent wrapped into Predicted
+func (l *Listener) SetPrediction(enabled bool) {
+	l.lock.Lock()
+	l.predict = enabled
+	l.lock.Unlock()
+	l.setDirty()
+}
+
+// FollowID makes one of the listener areas follow an object with a given id.
+// Every time the object is updated the area is set to a square
+// of radiusNM around the object's center. Following an object replaces
+// the previously followed one, other areas are kept intact
+func (l *Listener) FollowID(id string, radiusNM float64) {
+	l.Unfollow()
+
+	l.lock.Lock()
+	l.followID = id
+	l.followRadius = radiusNM
+	l.lock.Unlock()
+
+	if obj := l.srv.follow(l, id); obj != nil {
+		l.followMoved(obj)
+	}
 }
 
-// Stop stops the listener, closes all the channels so it's free to cleanup by GC
+// Unfollow stops following an object, the area is left as it is
+func (l *Listener) Unfollow() {
+	l.lock.Lock()
+	id := l.followID
+	l.followID = ""
+	l.followHandle = 0
+	l.lock.Unlock()
+
+	if id != "" {
+		l.srv.unfollow(l, id)
+	}
+}
+
+func (l *Listener) followMoved(obj Indexable) {
+	l.lock.RLock()
+	following := l.followID == obj.ID()
+	radius := l.followRadius
+	handle := l.followHandle
+	l.lock.RUnlock()
+
+	if following {
+		lat, lng := helper.Center(obj.Bounds())
+		handle = l.replaceBounds(handle, MapBoundsAround(lat, lng, radius))
+		l.lock.Lock()
+		l.followHandle = handle
+		l.lock.Unlock()
+		l.setDirty()
+	}
+}
+
+// Stop stops the listener, closes all the channels so it's free to cleanup by GC.
+// A listener blocked on a slow consumer is released as well
 func (l *Listener) Stop() {
-	l.disposeBoxes()
-	l.unsubscribeAll()
-	l.stopped = true
+	l.stopOnce.Do(func() {
+		l.lock.Lock()
+		l.stopped = true
+		l.lock.Unlock()
+
+		l.srv.unregister(l)
+		l.Unfollow()
+		l.disposeBoxes()
+		l.unsubscribeAll()
+		close(l.done)
+
+		// wait for a delivery in progress to quit before closing the channel
+		l.chLock.Lock()
+		close(l.ch)
+		if l.closeSink != nil {
+			l.closeSink()
+		}
+		l.chLock.Unlock()
+	})
 }
 
 // SubscribeID adds a specific id to watch
@@ -90,6 +328,7 @@ func (l *Listener) SubscribeID(id string) {
 	l.watchIds[id] = true
 	l.lock.Unlock()
 	l.srv.subscribeID(l, id)
+	l.setDirty()
 }
 
 // UnsubscribeID unsubscribes from a specific id
@@ -98,60 +337,138 @@ func (l *Listener) UnsubscribeID(id string) {
 	delete(l.watchIds, id)
 	l.lock.Unlock()
 	l.srv.unsubscribeID(l, id)
+	l.setDirty()
+}
+
+// Snapshot synchronously returns the objects currently seen by the listener
+func (l *Listener) Snapshot() []Indexable {
+	l.lock.RLock()
+	predict := l.predict
+	l.lock.RUnlock()
+	return l.collect(predict)
 }
 
 // ForceUpdate forces the dirty flag on
 func (l *Listener) ForceUpdate() {
-    l.setDirty()
+	l.setDirty()
 }
 
 func (l *Listener) setDirty() {
-	l.dirty = true
+	atomic.AddUint64(&l.dirtyMarks, 1)
+	if atomic.CompareAndSwapInt32(&l.dirty, 0, 1) {
+		atomic.StoreInt64(&l.dirtySince, time.Now().UnixNano())
+		l.srv.sched.schedule(l)
+	}
 }
 
-// Updates returns the update channel
+// Updates returns the update channel. Callback listeners never send
+// anything through it, the channel is only closed when they stop.
+// Updates carry no versions, use Server.NewVersionedListener to get them
 func (l *Listener) Updates() <-chan []Indexable {
 	return l.ch
 }
 
-func (l *Listener) loop() {
+// deliver passes objects to the consumer
+func (l *Listener) deliver(objects []Indexable) {
+	if l.callback != nil {
+		l.dispatch(objects)
+		return
+	}
+
+	l.chLock.RLock()
+	select {
+	case <-l.done:
+		// the channel is about to be closed
+		l.chLock.RUnlock()
+		return
+	default:
+	}
+	var err error
+	if l.sink != nil {
+		err = l.sink(l, objects)
+	} else {
+		err = l.send(objects)
+	}
+	l.chLock.RUnlock()
+
+	if err != nil {
+		l.fail(err)
+	}
+}
+
+func (l *Listener) collect(predict bool) []Indexable {
+	defer l.srv.getMetrics().observeSearch(searchOpListener, time.Now())
 	var rmap map[string]Indexable
-	t := time.NewTicker(l.updateInterval)
-	defer t.Stop()
+	objmap := make(map[string]Indexable)
+	now := time.Now()
 
-	for range t.C {
-		if l.stopped {
-			break
+	l.lock.RLock()
+	for key, obj := range l.srv.findObjectsByIDs(l.watchIds) {
+		if predict {
+			obj = l.srv.predict(obj, now)
 		}
+		objmap[key] = obj
+	}
+	filters := make([]rtreego.Filter, 0, 1)
+	if l.filter != nil {
+		filters = append(filters, l.filter)
+	}
+	groupMode := l.groupMode
+	l.lock.RUnlock()
 
-		if l.dirty {
-			objmap := make(map[string]Indexable)
+	if predict {
+		rmap = l.srv.findPredictedByBoundingBoxes(l.boxes(), now, filters...)
+	} else {
+		rmap = l.srv.findObjectsByBoundingBoxes(l.boxes(), filters...)
+	}
 
-			l.lock.RLock()
-			for key, obj := range l.srv.findObjectsByIDs(l.watchIds) {
-				objmap[key] = obj
-			}
-			l.lock.RUnlock()
+	for key, obj := range rmap {
+		if !skipByGroupMode(groupMode, obj) {
+			objmap[key] = obj
+		}
+	}
 
-			if l.filter == nil {
-				rmap = l.srv.findObjectsByBoundingBoxes(l.boxes)
-			} else {
-				rmap = l.srv.findObjectsByBoundingBoxes(l.boxes, l.filter)
-			}
+	objects := make([]Indexable, 0)
+	for _, obj := range objmap {
+		objects = append(objects, obj)
+	}
+	return objects
+}
 
-			for key, obj := range rmap {
-				objmap[key] = obj
-			}
+// startFlush runs a delivery in a separate goroutine unless
+// one is in progress already, it reschedules itself if needed
+func (l *Listener) startFlush() {
+	if atomic.CompareAndSwapInt32(&l.flushing, 0, 1) {
+		go l.flush()
+	}
+}
+
+func (l *Listener) flush() {
+	select {
+	case <-l.done:
+		atomic.StoreInt32(&l.flushing, 0)
+		return
+	default:
+	}
 
-			objects := make([]Indexable, 0)
-			for _, obj := range objmap {
-				objects = append(objects, obj)
-			}
+	l.lock.RLock()
+	predict := l.predict
+	l.lock.RUnlock()
 
-			l.ch <- objects
-			l.dirty = false
+	dirtySince := atomic.LoadInt64(&l.dirtySince)
+	dirty := atomic.SwapInt32(&l.dirty, 0) == 1
+	if dirty || predict {
+		l.deliver(l.collect(predict))
+		if dirty {
+			l.srv.getMetrics().observeDeliveryLag(time.Since(time.Unix(0, dirtySince)))
 		}
 	}
+	atomic.StoreInt32(&l.flushing, 0)
 
-	close(l.ch)
+	// the listener might get dirty while the delivery was in progress
+	// or it could have been skipped by the scheduler as busy.
+	// Predicted listeners are refreshed continuously
+	if predict || atomic.LoadInt32(&l.dirty) == 1 {
+		l.srv.sched.schedule(l)
+	}
 }
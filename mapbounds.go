@@ -1,6 +1,11 @@
 package spatial
 
-import "github.com/dhconnelly/rtreego"
+import (
+	"math"
+
+	"github.com/dhconnelly/rtreego"
+	"github.com/viert/spatial/helper"
+)
 
 const (
 	eastmostLongintude = 179.9999999
@@ -15,50 +20,72 @@ type MapBounds struct {
 	NorthEastLat float64
 }
 
-// Rect converts MapBounds to rtregoo Rect
-func (mb *MapBounds) rect() *rtreego.Rect {
+// rect converts MapBounds to rtregoo Rect
+func (mb *MapBounds) rect() (*rtreego.Rect, error) {
 	point := rtreego.Point{mb.SouthWestLat, mb.SouthWestLng}
 	lngSize := mb.NorthEastLng - mb.SouthWestLng
 	latSize := mb.NorthEastLat - mb.SouthWestLat
-	rect, _ := rtreego.NewRect(point, []float64{latSize, lngSize})
-	return rect
+	if !finite(latSize, lngSize) {
+		return nil, ErrNaNCoordinate
+	}
+	rect, err := rtreego.NewRect(point, []float64{latSize, lngSize})
+	if err != nil {
+		return nil, ErrInvertedBounds
+	}
+	return rect, nil
 }
 
+// split splits bounds crossing the antimeridian into western and eastern boxes.
+// Latitudes don't wrap, Validate rejects SouthWestLat above NorthEastLat
 func (mb *MapBounds) split() []*MapBounds {
-	boxes := make([]*MapBounds, 1)
-	boxes[0] = mb
-
-	if mb.SouthWestLng > mb.NorthEastLng {
-		temp := make([]*MapBounds, 0)
-		for _, box := range boxes {
-			// western box
-			temp = append(temp, &MapBounds{box.SouthWestLng, box.SouthWestLat, eastmostLongintude, box.NorthEastLat})
-			// eastern box
-			temp = append(temp, &MapBounds{-eastmostLongintude, box.SouthWestLat, box.NorthEastLng, box.NorthEastLat})
-		}
-		boxes = temp
+	if mb.SouthWestLng <= mb.NorthEastLng {
+		return []*MapBounds{mb}
 	}
-
-	if mb.SouthWestLat > mb.NorthEastLat {
-		temp := make([]*MapBounds, 0)
-		for _, box := range boxes {
-			// northern box
-			temp = append(temp, &MapBounds{box.SouthWestLng, box.SouthWestLat, box.NorthEastLng, northmostLatitude})
-			// southern box
-			temp = append(temp, &MapBounds{box.SouthWestLng, -northmostLatitude, box.NorthEastLng, box.NorthEastLat})
-		}
-		boxes = temp
+	return []*MapBounds{
+		{mb.SouthWestLng, mb.SouthWestLat, eastmostLongintude, mb.NorthEastLat},
+		{-eastmostLongintude, mb.SouthWestLat, mb.NorthEastLng, mb.NorthEastLat},
 	}
-
-	return boxes
 }
 
-// Rects returns a list of Rects supporint latitude/longitude wrapping
+// Rects returns a list of Rects supporting longitude wrapping.
+// Boxes of zero or NaN size are skipped as they cover nothing
 func (mb *MapBounds) Rects() []*rtreego.Rect {
 	boxes := mb.split()
-	rects := make([]*rtreego.Rect, len(boxes))
-	for i, box := range boxes {
-		rects[i] = box.rect()
+	rects := make([]*rtreego.Rect, 0, len(boxes))
+	for _, box := range boxes {
+		if rect, err := box.rect(); err == nil {
+			rects = append(rects, rect)
+		}
 	}
 	return rects
 }
+
+func wrapLongitude(lng float64) float64 {
+	lng = math.Mod(lng+180, 360)
+	if lng < 0 {
+		lng += 360
+	}
+	return lng - 180
+}
+
+// MapBoundsAround makes MapBounds covering a circle of a given radius
+// around a given point. Longitudes are wrapped around the antimeridian
+func MapBoundsAround(lat float64, lng float64, radiusNM float64) MapBounds {
+	rect := helper.SquareCentered(lat, lng, radiusNM*2)
+
+	mb := MapBounds{
+		SouthWestLat: math.Max(rect.PointCoord(0), -northmostLatitude),
+		NorthEastLat: math.Min(rect.PointCoord(0)+rect.LengthsCoord(0), northmostLatitude),
+	}
+
+	lngSize := rect.LengthsCoord(1)
+	if lngSize >= 360 || math.IsNaN(lngSize) {
+		// close to a pole the circle covers all the longitudes
+		mb.SouthWestLng = -eastmostLongintude
+		mb.NorthEastLng = eastmostLongintude
+	} else {
+		mb.SouthWestLng = wrapLongitude(rect.PointCoord(1))
+		mb.NorthEastLng = wrapLongitude(rect.PointCoord(1) + lngSize)
+	}
+	return mb
+}
@@ -0,0 +1,70 @@
+package spatial
+
+// UpdateMeta sets meta keys of an *Object with a given id in place, keys
+// not mentioned in meta are kept. The object is not re-inserted into the index,
+// listeners seeing the object and its ID subscribers are notified.
+// Returns false if there's no *Object with such id
+func (s *Server) UpdateMeta(id string, meta map[string]string) bool {
+	return s.patchMeta(id, func(o *Object) {
+		for key, value := range meta {
+			o.meta[key] = value
+		}
+	})
+}
+
+// DeleteMetaKey removes a meta key of an *Object with a given id in place,
+// see UpdateMeta. Returns false if there's no *Object with such id
+func (s *Server) DeleteMetaKey(id string, key string) bool {
+	return s.patchMeta(id, func(o *Object) {
+		delete(o.meta, key)
+	})
+}
+
+// UpdateAttrs sets attributes of an *Object with a given id in place,
+// see UpdateMeta. Returns false if there's no *Object with such id
+func (s *Server) UpdateAttrs(id string, attrs map[string]Attr) bool {
+	return s.patchMeta(id, func(o *Object) {
+		for key, attr := range attrs {
+			o.attrs[key] = attr
+		}
+	})
+}
+
+// DeleteAttr removes an attribute of an *Object with a given id in place,
+// see UpdateMeta. Returns false if there's no *Object with such id
+func (s *Server) DeleteAttr(id string, key string) bool {
+	return s.patchMeta(id, func(o *Object) {
+		delete(o.attrs, key)
+	})
+}
+
+func (s *Server) patchMeta(id string, patch func(o *Object)) bool {
+	lock := s.idLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	obj, found := s.Get(id)
+	if !found {
+		return false
+	}
+	o, ok := obj.(*Object)
+	if !ok {
+		return false
+	}
+
+	o.metaLock.Lock()
+	patch(o)
+	o.metaLock.Unlock()
+
+	s.lock.Lock()
+	s.lastVersion++
+	s.versions[id] = s.lastVersion
+	s.reindexMeta(id, o)
+	s.lock.Unlock()
+
+	for l := range collectListeners(s.findBoundingBoxesByObject(o)) {
+		l.setDirty()
+	}
+	s.markSubscribersDirty(id)
+	return true
+}
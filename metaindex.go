@@ -0,0 +1,247 @@
+package spatial
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/dhconnelly/rtreego"
+	"github.com/viert/spatial/internal/rtreeutil"
+)
+
+// MetaIndexKind is a kind of secondary index on a meta key
+type MetaIndexKind int
+
+const (
+	// MetaIndexHash supports exact value lookups
+	MetaIndexHash MetaIndexKind = iota
+	// MetaIndexSorted supports exact value and prefix lookups
+	MetaIndexSorted
+)
+
+// metaHolder is implemented by objects having meta, like *Object
+type metaHolder interface {
+	Meta(key string) string
+	HasMetaKey(key string) bool
+}
+
+// metaIndex maps values of a meta key to objects, it's guarded by the server lock
+type metaIndex struct {
+	kind   MetaIndexKind
+	key    string
+	values map[string]map[string]Indexable
+	byID   map[string]string
+	// sorted holds distinct values for MetaIndexSorted
+	sorted []string
+}
+
+func newMetaIndex(key string, kind MetaIndexKind) *metaIndex {
+	return &metaIndex{
+		kind:   kind,
+		key:    key,
+		values: make(map[string]map[string]Indexable),
+		byID:   make(map[string]string),
+	}
+}
+
+func (mi *metaIndex) insert(obj Indexable) {
+	mh, ok := obj.(metaHolder)
+	if !ok || !mh.HasMetaKey(mi.key) {
+		return
+	}
+	value := mh.Meta(mi.key)
+	ids, found := mi.values[value]
+	if !found {
+		ids = make(map[string]Indexable)
+		mi.values[value] = ids
+		if mi.kind == MetaIndexSorted {
+			i := sort.SearchStrings(mi.sorted, value)
+			mi.sorted = append(mi.sorted, "")
+			copy(mi.sorted[i+1:], mi.sorted[i:])
+			mi.sorted[i] = value
+		}
+	}
+	ids[obj.ID()] = obj
+	mi.byID[obj.ID()] = value
+}
+
+func (mi *metaIndex) remove(id string) {
+	value, found := mi.byID[id]
+	if !found {
+		return
+	}
+	delete(mi.byID, id)
+	ids := mi.values[value]
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(mi.values, value)
+		if mi.kind == MetaIndexSorted {
+			i := sort.SearchStrings(mi.sorted, value)
+			mi.sorted = append(mi.sorted[:i], mi.sorted[i+1:]...)
+		}
+	}
+}
+
+// find returns objects with a given value or, if prefix is set, with values
+// starting with it. False is returned if the index can't serve the lookup
+func (mi *metaIndex) find(value string, prefix bool) ([]Indexable, bool) {
+	objects := make([]Indexable, 0)
+	if !prefix {
+		for _, obj := range mi.values[value] {
+			objects = append(objects, obj)
+		}
+		return objects, true
+	}
+	if mi.kind != MetaIndexSorted {
+		return nil, false
+	}
+	for i := sort.SearchStrings(mi.sorted, value); i < len(mi.sorted) && strings.HasPrefix(mi.sorted[i], value); i++ {
+		for _, obj := range mi.values[mi.sorted[i]] {
+			objects = append(objects, obj)
+		}
+	}
+	return objects, true
+}
+
+// AddMetaIndex creates a secondary index on a meta key of objects having meta
+// like *Object, existing objects are indexed right away. The index is kept up
+// to date by Add, Remove and UpdateMeta and used by FindByMeta and Query
+func (s *Server) AddMetaIndex(key string, kind MetaIndexKind) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	mi := newMetaIndex(key, kind)
+	for _, obj := range s.idIdx {
+		mi.insert(obj)
+	}
+	s.metaIndexes[key] = mi
+}
+
+// reindexMeta updates meta indexes after obj with a given id has changed,
+// obj is nil if the object is removed. The server lock must be held
+func (s *Server) reindexMeta(id string, obj Indexable) {
+	for _, mi := range s.metaIndexes {
+		mi.remove(id)
+		if obj != nil {
+			mi.insert(obj)
+		}
+	}
+}
+
+// FindByMeta returns objects having a meta key set to a given value
+func (s *Server) FindByMeta(key string, value string) []Indexable {
+	return s.Query(Query{MetaKey: key, MetaValue: value})
+}
+
+// FindByMetaPrefix returns objects having a meta key value starting with prefix
+func (s *Server) FindByMetaPrefix(key string, prefix string) []Indexable {
+	return s.Query(Query{MetaKey: key, MetaValue: prefix, MetaPrefix: true})
+}
+
+// Query describes a search combining bounds, meta and filters
+type Query struct {
+	// Bounds to search in, nil stands for the whole index
+	Bounds *rtreego.Rect
+	// MetaKey is a meta key objects must have, empty means no meta condition
+	MetaKey   string
+	MetaValue string
+	// MetaPrefix makes MetaValue match as a prefix
+	MetaPrefix bool
+	Filters    []rtreego.Filter
+}
+
+func (q *Query) matchMeta(obj Indexable) bool {
+	mh, ok := obj.(metaHolder)
+	if !ok || !mh.HasMetaKey(q.MetaKey) {
+		return false
+	}
+	if q.MetaPrefix {
+		return strings.HasPrefix(mh.Meta(q.MetaKey), q.MetaValue)
+	}
+	return mh.Meta(q.MetaKey) == q.MetaValue
+}
+
+// queryPlan is a way Query is executed
+type queryPlan int
+
+const (
+	// planTree searches the spatial index checking meta with a filter
+	planTree queryPlan = iota
+	// planMetaIndex takes objects from a meta index checking bounds
+	planMetaIndex
+	// planScan checks every object
+	planScan
+)
+
+// plan picks the cheapest way to execute a query. Objects are assumed to be
+// spread evenly, so a spatial search is expected to find a share of objects
+// proportional to the share of the world it covers. Returns meta index
+// candidates if the meta index plan is picked
+func (s *Server) plan(q *Query) (queryPlan, []Indexable) {
+	s.lock.RLock()
+	total := len(s.idIdx)
+	var candidates []Indexable
+	indexed := false
+	if mi, found := s.metaIndexes[q.MetaKey]; found && q.MetaKey != "" {
+		candidates, indexed = mi.find(q.MetaValue, q.MetaPrefix)
+	}
+	s.lock.RUnlock()
+
+	if indexed {
+		if q.Bounds == nil {
+			return planMetaIndex, candidates
+		}
+		share := q.Bounds.LengthsCoord(0) * q.Bounds.LengthsCoord(1) / (180 * 360)
+		if float64(len(candidates)) <= share*float64(total) {
+			return planMetaIndex, candidates
+		}
+	}
+	if q.Bounds == nil {
+		return planScan, nil
+	}
+	return planTree, nil
+}
+
+// Query synchronously runs a query using a meta index or the spatial index,
+// whichever is expected to look through fewer objects
+func (s *Server) Query(q Query) []Indexable {
+	plan, candidates := s.plan(&q)
+	results := make([]rtreego.Spatial, 0)
+
+	switch plan {
+	case planTree:
+		filters := q.Filters
+		if q.MetaKey != "" {
+			metaFilter := func(results []rtreego.Spatial, obj rtreego.Spatial) (bool, bool) {
+				return !q.matchMeta(obj.(Indexable)), false
+			}
+			filters = append([]rtreego.Filter{metaFilter}, filters...)
+		}
+		for _, obj := range s.SearchIntersect(q.Bounds, filters...) {
+			results = append(results, obj)
+		}
+	default:
+		if plan == planScan {
+			candidates = s.Objects()
+		}
+		for _, obj := range candidates {
+			if q.Bounds != nil && !intersectsWrapped(obj.Bounds(), q.Bounds) {
+				continue
+			}
+			if q.MetaKey != "" && !q.matchMeta(obj) {
+				continue
+			}
+			refuse, abort := rtreeutil.ApplyFilters(results, obj, q.Filters)
+			if !refuse {
+				results = append(results, obj)
+			}
+			if abort {
+				break
+			}
+		}
+	}
+
+	objects := make([]Indexable, len(results))
+	for i, obj := range results {
+		objects[i] = obj.(Indexable)
+	}
+	return objects
+}
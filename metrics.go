@@ -0,0 +1,243 @@
+package spatial
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/viert/spatial/index"
+)
+
+var (
+	latencyBuckets = []float64{
+		.00005, .0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5,
+	}
+)
+
+// histogram is a lock-free Prometheus-like histogram of durations
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sumBits uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	v := d.Seconds()
+	for i, bound := range h.buckets {
+		if v <= bound {
+			atomic.AddUint64(&h.counts[i], 1)
+		}
+	}
+	atomic.AddUint64(&h.count, 1)
+	for {
+		old := atomic.LoadUint64(&h.sumBits)
+		sum := math.Float64frombits(old) + v
+		if atomic.CompareAndSwapUint64(&h.sumBits, old, math.Float64bits(sum)) {
+			return
+		}
+	}
+}
+
+func (h *histogram) write(w io.Writer, name string, labels string) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	for i, bound := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%g\"} %d\n", name, labels, sep, bound, atomic.LoadUint64(&h.counts[i]))
+	}
+	count := atomic.LoadUint64(&h.count)
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, count)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %g\n", name, labels, math.Float64frombits(atomic.LoadUint64(&h.sumBits)))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, count)
+}
+
+// Search operations measured by Metrics
+const (
+	searchOpIntersect = "intersect"
+	searchOpPredicted = "predicted"
+	searchOpListener  = "listener"
+	searchOpNearest   = "nearest"
+)
+
+// Metrics collects Server and listener metrics and exposes them
+// in Prometheus text exposition format
+type Metrics struct {
+	srv           *Server
+	adds          uint64
+	removes       uint64
+	addLatency    *histogram
+	removeLatency *histogram
+	searchLatency map[string]*histogram
+	deliveryLag   *histogram
+}
+
+// EnableMetrics installs a metrics collector on the server and returns it.
+// Metrics implements http.Handler so it can be served as /metrics directly
+func (s *Server) EnableMetrics() *Metrics {
+	m := &Metrics{
+		srv:           s,
+		addLatency:    newHistogram(latencyBuckets),
+		removeLatency: newHistogram(latencyBuckets),
+		searchLatency: map[string]*histogram{
+			searchOpIntersect: newHistogram(latencyBuckets),
+			searchOpPredicted: newHistogram(latencyBuckets),
+			searchOpListener:  newHistogram(latencyBuckets),
+			searchOpNearest:   newHistogram(latencyBuckets),
+		},
+		deliveryLag: newHistogram(latencyBuckets),
+	}
+	s.metrics.Store(m)
+	return m
+}
+
+// getMetrics returns the metrics collector or nil if metrics are not enabled
+func (s *Server) getMetrics() *Metrics {
+	m, _ := s.metrics.Load().(*Metrics)
+	return m
+}
+
+func (m *Metrics) observeAdd(started time.Time) {
+	if m != nil {
+		atomic.AddUint64(&m.adds, 1)
+		m.addLatency.observe(time.Since(started))
+	}
+}
+
+func (m *Metrics) observeRemove(started time.Time) {
+	if m != nil {
+		atomic.AddUint64(&m.removes, 1)
+		m.removeLatency.observe(time.Since(started))
+	}
+}
+
+func (m *Metrics) observeSearch(op string, started time.Time) {
+	if m != nil {
+		m.searchLatency[op].observe(time.Since(started))
+	}
+}
+
+func (m *Metrics) observeDeliveryLag(lag time.Duration) {
+	if m != nil {
+		m.deliveryLag.observe(lag)
+	}
+}
+
+// WriteTo writes the metrics in Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	srv := m.srv
+
+	srv.lock.RLock()
+	objects := make(map[IndexableType]int, len(srv.counts))
+	for t, n := range srv.counts {
+		objects[t] = n
+	}
+	subs := 0
+	for _, lmap := range srv.idSubs {
+		subs += len(lmap)
+	}
+	listeners := len(srv.listeners)
+	srv.lock.RUnlock()
+
+	types := make([]int, 0, len(objects))
+	for t := range objects {
+		types = append(types, int(t))
+	}
+	sort.Ints(types)
+
+	fmt.Fprintln(bw, "# HELP spatial_objects Number of indexed objects by type.")
+	fmt.Fprintln(bw, "# TYPE spatial_objects gauge")
+	for _, t := range types {
+		fmt.Fprintf(bw, "spatial_objects{type=\"%d\"} %d\n", t, objects[IndexableType(t)])
+	}
+
+	fmt.Fprintln(bw, "# HELP spatial_adds_total Number of Add calls.")
+	fmt.Fprintln(bw, "# TYPE spatial_adds_total counter")
+	fmt.Fprintf(bw, "spatial_adds_total %d\n", atomic.LoadUint64(&m.adds))
+
+	fmt.Fprintln(bw, "# HELP spatial_removes_total Number of Remove calls.")
+	fmt.Fprintln(bw, "# TYPE spatial_removes_total counter")
+	fmt.Fprintf(bw, "spatial_removes_total %d\n", atomic.LoadUint64(&m.removes))
+
+	fmt.Fprintln(bw, "# HELP spatial_stale_writes_total Number of ignored writes of stale Versioned objects.")
+	fmt.Fprintln(bw, "# TYPE spatial_stale_writes_total counter")
+	fmt.Fprintf(bw, "spatial_stale_writes_total %d\n", srv.StaleWrites())
+
+	fmt.Fprintln(bw, "# HELP spatial_invalid_writes_total Number of writes rejected for invalid bounds.")
+	fmt.Fprintln(bw, "# TYPE spatial_invalid_writes_total counter")
+	fmt.Fprintf(bw, "spatial_invalid_writes_total %d\n", srv.InvalidWrites())
+
+	fmt.Fprintln(bw, "# HELP spatial_add_duration_seconds Add latency including listener notification.")
+	fmt.Fprintln(bw, "# TYPE spatial_add_duration_seconds histogram")
+	m.addLatency.write(bw, "spatial_add_duration_seconds", "")
+
+	fmt.Fprintln(bw, "# HELP spatial_remove_duration_seconds Remove latency including listener notification.")
+	fmt.Fprintln(bw, "# TYPE spatial_remove_duration_seconds histogram")
+	m.removeLatency.write(bw, "spatial_remove_duration_seconds", "")
+
+	fmt.Fprintln(bw, "# HELP spatial_search_duration_seconds Search latency by operation.")
+	fmt.Fprintln(bw, "# TYPE spatial_search_duration_seconds histogram")
+	for _, op := range []string{searchOpIntersect, searchOpPredicted, searchOpListener, searchOpNearest} {
+		m.searchLatency[op].write(bw, "spatial_search_duration_seconds", fmt.Sprintf("op=\"%s\"", op))
+	}
+
+	fmt.Fprintln(bw, "# HELP spatial_tree_entries Number of entries in the index tree including listener bounding boxes.")
+	fmt.Fprintln(bw, "# TYPE spatial_tree_entries gauge")
+	fmt.Fprintf(bw, "spatial_tree_entries %d\n", srv.tree.Len())
+
+	if d, ok := srv.tree.(index.Depther); ok {
+		fmt.Fprintln(bw, "# HELP spatial_tree_depth Depth of the index tree.")
+		fmt.Fprintln(bw, "# TYPE spatial_tree_depth gauge")
+		fmt.Fprintf(bw, "spatial_tree_depth %d\n", d.Depth())
+	}
+
+	fmt.Fprintln(bw, "# HELP spatial_listeners Number of active listeners.")
+	fmt.Fprintln(bw, "# TYPE spatial_listeners gauge")
+	fmt.Fprintf(bw, "spatial_listeners %d\n", listeners)
+
+	fmt.Fprintln(bw, "# HELP spatial_id_subscriptions Number of listener subscriptions to object ids.")
+	fmt.Fprintln(bw, "# TYPE spatial_id_subscriptions gauge")
+	fmt.Fprintf(bw, "spatial_id_subscriptions %d\n", subs)
+
+	fmt.Fprintln(bw, "# HELP spatial_listener_delivery_lag_seconds Time between a listener getting dirty and the update delivery.")
+	fmt.Fprintln(bw, "# TYPE spatial_listener_delivery_lag_seconds histogram")
+	m.deliveryLag.write(bw, "spatial_listener_delivery_lag_seconds", "")
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP implements http.Handler
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
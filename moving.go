@@ -0,0 +1,140 @@
+package spatial
+
+import (
+	"time"
+
+	"github.com/dhconnelly/rtreego"
+	"github.com/viert/spatial/helper"
+)
+
+const (
+	// DefaultPredictionHorizon is the default limit of position extrapolation
+	DefaultPredictionHorizon = 30 * time.Second
+)
+
+// Moving is an optional interface Indexable implementations may satisfy
+// to get their positions extrapolated (dead-reckoned) between reports
+type Moving interface {
+	// Velocity returns ground speed in knots
+	Velocity() float64
+	// Heading returns track in degrees, 0 is north, 90 is east
+	Heading() float64
+	// Timestamp returns the time the object's bounds were reported at
+	Timestamp() time.Time
+}
+
+// Predicted is an Indexable wrapper carrying extrapolated bounds
+// of a Moving object
+type Predicted struct {
+	Indexable
+	bounds *rtreego.Rect
+	at     time.Time
+}
+
+// Bounds implements Indexable returning extrapolated bounds
+func (p *Predicted) Bounds() *rtreego.Rect {
+	return p.bounds
+}
+
+// At returns the time the bounds were extrapolated for
+func (p *Predicted) At() time.Time {
+	return p.at
+}
+
+// Original returns the wrapped object as it was reported
+func (p *Predicted) Original() Indexable {
+	return p.Indexable
+}
+
+// SetPredictionHorizon limits how far in time positions of Moving objects
+// are extrapolated. The longer the horizon is, the larger the area
+// predicted searches have to look through
+func (s *Server) SetPredictionHorizon(horizon time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.predictionHorizon = horizon
+}
+
+func (s *Server) trackVelocity(obj Indexable) {
+	if m, ok := obj.(Moving); ok {
+		s.lock.Lock()
+		if v := m.Velocity(); v > s.maxVelocity {
+			s.maxVelocity = v
+		}
+		s.lock.Unlock()
+	}
+}
+
+// maxTravel returns the maximum distance in nautical miles
+// any of the objects may be extrapolated by
+func (s *Server) maxTravel() float64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.maxVelocity * s.predictionHorizon.Hours()
+}
+
+func (s *Server) predict(obj Indexable, at time.Time) Indexable {
+	m, ok := obj.(Moving)
+	if !ok {
+		return obj
+	}
+
+	s.lock.RLock()
+	horizon := s.predictionHorizon
+	s.lock.RUnlock()
+
+	elapsed := at.Sub(m.Timestamp())
+	if elapsed > horizon {
+		elapsed = horizon
+	} else if elapsed < -horizon {
+		elapsed = -horizon
+	}
+
+	distance := m.Velocity() * elapsed.Hours()
+	return &Predicted{
+		Indexable: obj,
+		bounds:    helper.Offset(obj.Bounds(), distance, m.Heading()),
+		at:        at,
+	}
+}
+
+// SearchIntersectPredicted syncronously searches for objects which extrapolated
+// bounds at a given time intersect with bb. Moving objects are returned
+// wrapped into Predicted, the others are returned as is
+func (s *Server) SearchIntersectPredicted(bb *rtreego.Rect, at time.Time, filters ...rtreego.Filter) map[string]Indexable {
+	defer s.getMetrics().observeSearch(searchOpPredicted, time.Now())
+	results := make(map[string]Indexable)
+
+	rect := bb
+	if travel := s.maxTravel(); travel > 0 {
+		rect = helper.Expand(bb, travel)
+	}
+
+	filters = unwrapFilters(filters)
+	for _, part := range splitRect(rect) {
+		for _, sp := range s.tree.SearchIntersect(part, filters...) {
+			idxbl, ok := unwrap(sp).(Indexable)
+			if !ok || idxbl.Type() <= 0 {
+				continue
+			}
+			if _, found := results[idxbl.ID()]; found {
+				continue
+			}
+			predicted := s.predict(idxbl, at)
+			if intersectsWrapped(predicted.Bounds(), bb) {
+				results[idxbl.ID()] = predicted
+			}
+		}
+	}
+	return results
+}
+
+func (s *Server) findPredictedByBoundingBoxes(boxes []*boundingBox, at time.Time, filters ...rtreego.Filter) map[string]Indexable {
+	results := make(map[string]Indexable)
+	for _, box := range boxes {
+		for id, obj := range s.SearchIntersectPredicted(box.bounds, at, filters...) {
+			results[id] = obj
+		}
+	}
+	return results
+}
@@ -0,0 +1,222 @@
+package spatial
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/viert/spatial/helper"
+)
+
+// ProximityEvent is emitted by ProximityMonitor when a pair of objects
+// comes within or goes beyond the monitor's threshold
+type ProximityEvent struct {
+	A        Indexable
+	B        Indexable
+	Distance float64 // distance between object centers in nautical miles
+	Entered  bool    // true if the pair came within the threshold, false if it left
+}
+
+// ProximityMonitor watches for pairs of objects of given types coming
+// close to each other. A pair enters proximity when the distance gets less than
+// the threshold and leaves it when the distance exceeds threshold + hysteresis.
+// Events are sent without blocking writers, the ones not fitting into
+// the channel are dropped and counted. The pair state is kept as is then,
+// so the transition is detected again when either object is written next
+type ProximityMonitor struct {
+	srv        *Server
+	typesA     map[IndexableType]bool
+	typesB     map[IndexableType]bool
+	threshold  float64
+	hysteresis float64
+	ch         chan ProximityEvent
+	stopOnce   sync.Once
+	dropped    uint64
+	// lock guards near and serializes events
+	lock    sync.Mutex
+	near    map[string]map[string]Indexable
+	stopped bool
+}
+
+func typeSet(types []IndexableType) map[IndexableType]bool {
+	set := make(map[IndexableType]bool)
+	for _, t := range types {
+		set[t] = true
+	}
+	return set
+}
+
+// NewProximityMonitor creates and returns a new ProximityMonitor watching for objects
+// of typesA coming within thresholdNM nautical miles of objects of typesB
+func (s *Server) NewProximityMonitor(typesA []IndexableType, typesB []IndexableType, thresholdNM float64, hysteresisNM float64, chSize int) *ProximityMonitor {
+	m := &ProximityMonitor{
+		srv:        s,
+		typesA:     typeSet(typesA),
+		typesB:     typeSet(typesB),
+		threshold:  thresholdNM,
+		hysteresis: hysteresisNM,
+		ch:         make(chan ProximityEvent, chSize),
+		near:       make(map[string]map[string]Indexable),
+	}
+	s.lock.Lock()
+	s.monitors[m] = m
+	s.lock.Unlock()
+	return m
+}
+
+// Events returns the proximity events channel
+func (m *ProximityMonitor) Events() <-chan ProximityEvent {
+	return m.ch
+}
+
+// Dropped returns the number of events dropped because the channel was full
+func (m *ProximityMonitor) Dropped() uint64 {
+	return atomic.LoadUint64(&m.dropped)
+}
+
+// Stop detaches the monitor from the server and closes the events channel
+func (m *ProximityMonitor) Stop() {
+	m.srv.lock.Lock()
+	delete(m.srv.monitors, m)
+	m.srv.lock.Unlock()
+
+	m.stopOnce.Do(func() {
+		m.lock.Lock()
+		m.stopped = true
+		close(m.ch)
+		m.lock.Unlock()
+	})
+}
+
+// pair orders objects so that A is of one of typesA and B is of one of typesB.
+// ok is false if the objects can't form a pair
+func (m *ProximityMonitor) pair(a Indexable, b Indexable) (Indexable, Indexable, bool) {
+	if m.typesA[a.Type()] && m.typesB[b.Type()] {
+		if m.typesA[b.Type()] && m.typesB[a.Type()] && b.ID() < a.ID() {
+			// both orders are possible, make it stable
+			return b, a, true
+		}
+		return a, b, true
+	}
+	if m.typesA[b.Type()] && m.typesB[a.Type()] {
+		return b, a, true
+	}
+	return nil, nil, false
+}
+
+func (m *ProximityMonitor) watches(obj Indexable) bool {
+	return m.typesA[obj.Type()] || m.typesB[obj.Type()]
+}
+
+func distanceNM(a Indexable, b Indexable) float64 {
+	latA, lngA := helper.Center(a.Bounds())
+	latB, lngB := helper.Center(b.Bounds())
+	return helper.DistanceNM(latA, lngA, latB, lngB)
+}
+
+func (m *ProximityMonitor) link(a Indexable, b Indexable) {
+	if _, found := m.near[a.ID()]; !found {
+		m.near[a.ID()] = make(map[string]Indexable)
+	}
+	if _, found := m.near[b.ID()]; !found {
+		m.near[b.ID()] = make(map[string]Indexable)
+	}
+	m.near[a.ID()][b.ID()] = b
+	m.near[b.ID()][a.ID()] = a
+}
+
+func (m *ProximityMonitor) unlink(a string, b string) {
+	delete(m.near[a], b)
+	if len(m.near[a]) == 0 {
+		delete(m.near, a)
+	}
+	delete(m.near[b], a)
+	if len(m.near[b]) == 0 {
+		delete(m.near, b)
+	}
+}
+
+// emit sends an event returning false if it's dropped
+func (m *ProximityMonitor) emit(a Indexable, b Indexable, distance float64, entered bool) bool {
+	a, b, _ = m.pair(a, b)
+	// check runs under the object's id lock, a slow consumer
+	// must not block writers
+	select {
+	case m.ch <- ProximityEvent{A: a, B: b, Distance: distance, Entered: entered}:
+		return true
+	default:
+		atomic.AddUint64(&m.dropped, 1)
+		return false
+	}
+}
+
+// check is called by the server every time obj is added or moved
+func (m *ProximityMonitor) check(obj Indexable) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.stopped {
+		return
+	}
+
+	seen := make(map[string]bool)
+	if m.watches(obj) {
+		area := helper.Expand(obj.Bounds(), m.threshold+m.hysteresis)
+		for id, other := range m.srv.SearchIntersect(area) {
+			if id == obj.ID() {
+				continue
+			}
+			if _, _, ok := m.pair(obj, other); !ok {
+				continue
+			}
+			seen[id] = true
+
+			d := distanceNM(obj, other)
+			_, wasNear := m.near[obj.ID()][id]
+			if !wasNear && d < m.threshold {
+				if m.emit(obj, other, d, true) {
+					m.link(obj, other)
+				}
+			} else if wasNear && d > m.threshold+m.hysteresis {
+				if m.emit(obj, other, d, false) {
+					m.unlink(obj.ID(), id)
+				}
+			} else if wasNear {
+				// keep the latest version of the object
+				m.link(obj, other)
+			}
+		}
+	}
+
+	// the objects not found nearby are definitely beyond the hysteresis range
+	for id, other := range m.near[obj.ID()] {
+		if !seen[id] && m.emit(obj, other, distanceNM(obj, other), false) {
+			m.unlink(obj.ID(), id)
+		}
+	}
+}
+
+// forget is called by the server when obj is removed from the index
+func (m *ProximityMonitor) forget(obj Indexable) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.stopped {
+		return
+	}
+
+	// pairs with dropped events are left to be detected
+	// when the other object is written next
+	for id, other := range m.near[obj.ID()] {
+		if m.emit(obj, other, distanceNM(obj, other), false) {
+			m.unlink(obj.ID(), id)
+		}
+	}
+}
+
+func (s *Server) collectMonitors() []*ProximityMonitor {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	monitors := make([]*ProximityMonitor, 0, len(s.monitors))
+	for m := range s.monitors {
+		monitors = append(monitors, m)
+	}
+	return monitors
+}
@@ -1,36 +1,113 @@
 package rtree
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/dhconnelly/rtreego"
+	"github.com/viert/spatial/internal/rtreeutil"
 )
 
 // SafeRtree is a thread-safe wrapper for rtreego Rtree
+//
+// Bulk loaded objects are kept in a separate read-only tree: leaves of a bulk
+// loaded rtreego tree share the same underlying array, so inserting into
+// one of them overwrites its neighbour. Objects deleted from the packed tree
+// are only marked, the tree is repacked once most of them are gone
 type SafeRtree struct {
-	tree *rtreego.Rtree
-	lock sync.RWMutex
+	tree       *rtreego.Rtree
+	packed     *rtreego.Rtree
+	packedObjs map[rtreego.Spatial]struct{}
+	dim        int
+	minBranch  int
+	maxBranch  int
+	lock       sync.RWMutex
 }
 
 // New creates a new SafeRtree
 func New(dim int, minBranch int, maxBranch int) *SafeRtree {
 	return &SafeRtree{
-		tree: rtreego.NewTree(dim, minBranch, maxBranch),
+		tree:      rtreego.NewTree(dim, minBranch, maxBranch),
+		dim:       dim,
+		minBranch: minBranch,
+		maxBranch: maxBranch,
 	}
 }
 
+// BulkLoad replaces all the objects in Rtree with objs. The tree is packed
+// with OMT bulk loading which is much faster than inserting objects one by one
+// and makes searches faster as well. OMT is used instead of STR as it's the
+// packing rtreego implements: its nodes can't be built from the outside, and
+// inserting objects in STR order is slower than plain inserts
+func (srt *SafeRtree) BulkLoad(objs []rtreego.Spatial) {
+	packed, packedObjs := srt.pack(objs)
+	tree := rtreego.NewTree(srt.dim, srt.minBranch, srt.maxBranch)
+
+	srt.lock.Lock()
+	defer srt.lock.Unlock()
+	srt.tree = tree
+	srt.packed = packed
+	srt.packedObjs = packedObjs
+}
+
+func (srt *SafeRtree) pack(objs []rtreego.Spatial) (*rtreego.Rtree, map[rtreego.Spatial]struct{}) {
+	if len(objs) == 0 {
+		return nil, nil
+	}
+	packedObjs := make(map[rtreego.Spatial]struct{}, len(objs))
+	for _, obj := range objs {
+		packedObjs[obj] = struct{}{}
+	}
+	return rtreego.NewTree(srt.dim, srt.minBranch, srt.maxBranch, objs...), packedObjs
+}
+
+// packedAlive is a filter refusing objects deleted from the packed tree
+func (srt *SafeRtree) packedAlive(results []rtreego.Spatial, obj rtreego.Spatial) (bool, bool) {
+	_, found := srt.packedObjs[obj]
+	return !found, false
+}
+
 // SearchIntersect searches for objects intersecting with a given Rect
 func (srt *SafeRtree) SearchIntersect(bb *rtreego.Rect, filters ...rtreego.Filter) []rtreego.Spatial {
 	srt.lock.RLock()
 	defer srt.lock.RUnlock()
-	return srt.tree.SearchIntersect(bb, filters...)
+	results := srt.tree.SearchIntersect(bb, filters...)
+	if srt.packed == nil {
+		return results
+	}
+
+	for _, obj := range srt.packed.SearchIntersect(bb, srt.packedAlive) {
+		refuse, abort := rtreeutil.ApplyFilters(results, obj, filters)
+		if !refuse {
+			results = append(results, obj)
+		}
+		if abort {
+			break
+		}
+	}
+	return results
 }
 
 // Delete removes an object from Rtree
 func (srt *SafeRtree) Delete(obj rtreego.Spatial) bool {
 	srt.lock.Lock()
 	defer srt.lock.Unlock()
-	return srt.tree.Delete(obj)
+	if srt.tree.Delete(obj) {
+		return true
+	}
+	if _, found := srt.packedObjs[obj]; !found {
+		return false
+	}
+
+	delete(srt.packedObjs, obj)
+	if len(srt.packedObjs) < srt.packed.Size()/2 {
+		objs := make([]rtreego.Spatial, 0, len(srt.packedObjs))
+		for obj := range srt.packedObjs {
+			objs = append(objs, obj)
+		}
+		srt.packed, srt.packedObjs = srt.pack(objs)
+	}
+	return true
 }
 
 // Insert inserts an object to Rtree
@@ -39,3 +116,45 @@ func (srt *SafeRtree) Insert(obj rtreego.Spatial) {
 	defer srt.lock.Unlock()
 	srt.tree.Insert(obj)
 }
+
+// Nearest returns up to k objects closest to a given point
+func (srt *SafeRtree) Nearest(p rtreego.Point, k int, filters ...rtreego.Filter) []rtreego.Spatial {
+	srt.lock.RLock()
+	defer srt.lock.RUnlock()
+	results := srt.tree.NearestNeighbors(k, p, filters...)
+	if srt.packed == nil {
+		return results
+	}
+
+	packedFilters := append([]rtreego.Filter{srt.packedAlive}, filters...)
+	results = append(results, srt.packed.NearestNeighbors(k, p, packedFilters...)...)
+	sort.SliceStable(results, func(i, j int) bool {
+		return rtreeutil.MinDist(p, results[i].Bounds()) < rtreeutil.MinDist(p, results[j].Bounds())
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// Len returns the number of objects in Rtree
+func (srt *SafeRtree) Len() int {
+	return srt.Size()
+}
+
+// Size returns the number of objects in Rtree
+func (srt *SafeRtree) Size() int {
+	srt.lock.RLock()
+	defer srt.lock.RUnlock()
+	return srt.tree.Size() + len(srt.packedObjs)
+}
+
+// Depth returns the height of Rtree
+func (srt *SafeRtree) Depth() int {
+	srt.lock.RLock()
+	defer srt.lock.RUnlock()
+	if srt.packed != nil && srt.packed.Depth() > srt.tree.Depth() {
+		return srt.packed.Depth()
+	}
+	return srt.tree.Depth()
+}
@@ -0,0 +1,118 @@
+package spatial
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// listenerQueue is a min-heap of listeners ordered by the time
+// they are allowed to deliver the next update at
+type listenerQueue []*Listener
+
+func (q listenerQueue) Len() int {
+	return len(q)
+}
+
+func (q listenerQueue) Less(i, j int) bool {
+	return q[i].dueAt.Before(q[j].dueAt)
+}
+
+func (q listenerQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *listenerQueue) Push(x interface{}) {
+	*q = append(*q, x.(*Listener))
+}
+
+func (q *listenerQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	l := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return l
+}
+
+// scheduler is a single dispatcher goroutine waking up only the listeners
+// which became dirty, each not more often than its update interval.
+// Idle listeners cost nothing but memory
+type scheduler struct {
+	lock  sync.Mutex
+	queue listenerQueue
+	wake  chan struct{}
+	once  sync.Once
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{
+		queue: make(listenerQueue, 0),
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// schedule queues a listener for delivery unless it's queued already
+func (s *scheduler) schedule(l *Listener) {
+	s.once.Do(func() {
+		go s.loop()
+	})
+
+	s.lock.Lock()
+	if l.queued {
+		s.lock.Unlock()
+		return
+	}
+	l.queued = true
+	l.dueAt = l.lastDelivery.Add(l.updateInterval)
+	heap.Push(&s.queue, l)
+	first := s.queue[0] == l
+	s.lock.Unlock()
+
+	if first {
+		// the dispatcher may be sleeping until a later time
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *scheduler) loop() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		s.lock.Lock()
+		if len(s.queue) == 0 {
+			s.lock.Unlock()
+			<-s.wake
+			continue
+		}
+
+		now := time.Now()
+		l := s.queue[0]
+		if wait := l.dueAt.Sub(now); wait > 0 {
+			s.lock.Unlock()
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-s.wake:
+			}
+			continue
+		}
+
+		heap.Pop(&s.queue)
+		l.queued = false
+		l.lastDelivery = now
+		s.lock.Unlock()
+
+		l.startFlush()
+	}
+}
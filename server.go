@@ -2,27 +2,92 @@ package spatial
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dhconnelly/rtreego"
+	"github.com/viert/spatial/index"
 	"github.com/viert/spatial/rtree"
 )
 
 // Server represents spatial index server
 type Server struct {
-	tree   *rtree.SafeRtree
+	tree   index.Index
 	idSubs map[string]map[*Listener]*Listener
 	idIdx  map[string]Indexable
+	counts map[IndexableType]int
 	lock   sync.RWMutex
+
+	// versions are unique across the server, so an object removed
+	// and added again never gets any of its previous versions
+	versions    map[string]uint64
+	lastVersion uint64
+	idLocks     [idLockStripes]sync.Mutex
+	metaIndexes map[string]*metaIndex
+
+	// groups maps group ids to their members
+	groups    map[string]map[string]Indexable
+	groupLock sync.Mutex
+
+	// fragments maps ids of objects crossing the antimeridian
+	// to the parts they are indexed as
+	fragments map[string][]rtreego.Spatial
+
+	maxVelocity       float64
+	predictionHorizon time.Duration
+
+	monitors  map[*ProximityMonitor]*ProximityMonitor
+	followers map[string]map[*Listener]*Listener
+	pool      *workerPool
+	sched     *scheduler
+	listeners map[*Listener]*Listener
+	metrics   atomic.Value
+
+	staleWrites   uint64
+	invalidWrites uint64
 }
 
-// New creates and initializes a new spatial Server
+// New creates and initializes a new spatial Server backed by an R-tree
 func New(minBranch int, maxBranch int) *Server {
-	t := rtree.New(2, minBranch, maxBranch)
+	return NewWithIndex(rtree.New(2, minBranch, maxBranch))
+}
+
+// NewSharded creates and initializes a new spatial Server backed by R-trees
+// sharded into latStripes x lngStripes parts of the world, each with its own lock
+func NewSharded(latStripes int, lngStripes int, minBranch int, maxBranch int) *Server {
+	return NewWithIndex(index.NewSharded(latStripes, lngStripes, func() index.Index {
+		return rtree.New(2, minBranch, maxBranch)
+	}))
+}
+
+// NewCOW creates and initializes a new spatial Server backed by a copy-on-write
+// index. Searches never block and see consistent point-in-time views of the index,
+// writes get more expensive as the index is rebuilt after every maxDelta changes
+func NewCOW(minBranch int, maxBranch int, maxDelta int) *Server {
+	return NewWithIndex(index.NewCOW(minBranch, maxBranch, maxDelta))
+}
+
+// NewWithIndex creates and initializes a new spatial Server
+// backed by a given index implementation
+func NewWithIndex(idx index.Index) *Server {
 	return &Server{
-		tree:   t,
+		tree:   idx,
 		idSubs: make(map[string]map[*Listener]*Listener),
 		idIdx:  make(map[string]Indexable),
+		counts: make(map[IndexableType]int),
+
+		versions:    make(map[string]uint64),
+		metaIndexes: make(map[string]*metaIndex),
+		groups:      make(map[string]map[string]Indexable),
+		fragments:   make(map[string][]rtreego.Spatial),
+
+		predictionHorizon: DefaultPredictionHorizon,
+
+		monitors:  make(map[*ProximityMonitor]*ProximityMonitor),
+		followers: make(map[string]map[*Listener]*Listener),
+		pool:      newWorkerPool(0),
+		sched:     newScheduler(),
+		listeners: make(map[*Listener]*Listener),
 	}
 }
 
@@ -45,6 +110,83 @@ func (s *Server) unsubscribeID(l *Listener, id string) {
 	}
 }
 
+func (s *Server) follow(l *Listener, id string) Indexable {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, found := s.followers[id]; !found {
+		s.followers[id] = make(map[*Listener]*Listener)
+	}
+	s.followers[id][l] = l
+	return s.idIdx[id]
+}
+
+func (s *Server) unfollow(l *Listener, id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if lmap, found := s.followers[id]; found {
+		delete(lmap, l)
+		if len(lmap) == 0 {
+			delete(s.followers, id)
+		}
+	}
+}
+
+func (s *Server) collectFollowers(id string) []*Listener {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	followers := make([]*Listener, 0, len(s.followers[id]))
+	for l := range s.followers[id] {
+		followers = append(followers, l)
+	}
+	return followers
+}
+
+func (s *Server) markSubscribersDirty(id string) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for l := range s.idSubs[id] {
+		l.setDirty()
+	}
+}
+
+// storeObject puts obj into the id index returning the object it replaces,
+// the server lock must be held
+func (s *Server) storeObject(obj Indexable) (Indexable, bool) {
+	curr, found := s.idIdx[obj.ID()]
+	if found {
+		s.uncount(curr)
+	}
+	s.idIdx[obj.ID()] = obj
+	s.counts[obj.Type()]++
+	s.lastVersion++
+	s.versions[obj.ID()] = s.lastVersion
+	s.reindexMeta(obj.ID(), obj)
+	s.trackMember(curr, obj)
+	return curr, found
+}
+
+// deleteObject removes an object with a given id from the id index
+// returning the removed object, the server lock must be held
+func (s *Server) deleteObject(id string) (Indexable, bool) {
+	curr, found := s.idIdx[id]
+	if found {
+		delete(s.idIdx, id)
+		delete(s.versions, id)
+		s.reindexMeta(id, nil)
+		s.trackMember(curr, nil)
+		s.uncount(curr)
+	}
+	return curr, found
+}
+
+// uncount decrements the count of objects of obj's type dropping
+// zero counts, the server lock must be held
+func (s *Server) uncount(obj Indexable) {
+	if s.counts[obj.Type()]--; s.counts[obj.Type()] == 0 {
+		delete(s.counts, obj.Type())
+	}
+}
+
 func (s *Server) findObjectsByIDs(ids map[string]bool) map[string]Indexable {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
@@ -58,16 +200,46 @@ func (s *Server) findObjectsByIDs(ids map[string]bool) map[string]Indexable {
 	return results
 }
 
-func (s *Server) findObjectsByBoundingBoxes(boxes []*boundingBox, filters ...rtreego.Filter) map[string]Indexable {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
+// reader returns a consistent view of the index if it supports snapshots
+func (s *Server) reader() index.Reader {
+	if snap, ok := s.tree.(index.Snapshotter); ok {
+		return snap.Snapshot()
+	}
+	return s.tree
+}
+
+// replaceInIndex replaces curr with obj in one step if the index supports
+// batches, curr may be nil
+func (s *Server) replaceInIndex(curr Indexable, obj Indexable) {
+	var deletes []rtreego.Spatial
+	if curr != nil {
+		deletes = s.takeEntries(curr)
+	}
+	inserts := s.makeEntries(obj)
+
+	if batcher, ok := s.tree.(index.Batcher); ok {
+		batcher.Batch(deletes, inserts)
+		return
+	}
 
+	for _, sp := range deletes {
+		s.tree.Delete(sp)
+	}
+	for _, sp := range inserts {
+		s.tree.Insert(sp)
+	}
+}
+
+func (s *Server) findObjectsByBoundingBoxes(boxes []*boundingBox, filters ...rtreego.Filter) map[string]Indexable {
 	results := make(map[string]Indexable)
+	// all the boxes are searched within the same point-in-time view
+	reader := s.reader()
+	filters = unwrapFilters(filters)
 	for _, box := range boxes {
 		rect := box.bounds
-		spatials := s.tree.SearchIntersect(rect, filters...)
+		spatials := reader.SearchIntersect(rect, filters...)
 		for _, sp := range spatials {
-			if idxbl, ok := sp.(Indexable); ok {
+			if idxbl, ok := unwrap(sp).(Indexable); ok {
 				if idxbl.Type() > 0 {
 					results[idxbl.ID()] = idxbl
 				}
@@ -79,11 +251,12 @@ func (s *Server) findObjectsByBoundingBoxes(boxes []*boundingBox, filters ...rtr
 }
 
 func (s *Server) findBoundingBoxesByObject(idx Indexable) []boundingBox {
-	intersections := s.tree.SearchIntersect(idx.Bounds(), filterBoundingBoxes)
 	boxes := make([]boundingBox, 0)
-	for _, obj := range intersections {
-		if idxbl, ok := obj.(Indexable); ok {
-			if box, ok := idxbl.(*boundingBox); ok {
+	seen := make(map[*boundingBox]bool)
+	for _, rect := range splitRect(idx.Bounds()) {
+		for _, obj := range s.tree.SearchIntersect(rect, filterBoundingBoxes) {
+			if box, ok := obj.(*boundingBox); ok && !seen[box] {
+				seen[box] = true
 				boxes = append(boxes, *box)
 			}
 		}
@@ -92,25 +265,41 @@ func (s *Server) findBoundingBoxesByObject(idx Indexable) []boundingBox {
 }
 
 // Add adds a new object if it doesn't exist (checking by it's ID())
-// or modifies existing one, and notifies listeners
+// or modifies existing one, and notifies listeners. Versioned objects
+// not newer than the existing ones and objects with invalid bounds are ignored
+// and counted by StaleWrites and InvalidWrites, use Put to get the reason. See Put on longitudes outside of [-180, 180]
 func (s *Server) Add(obj Indexable) {
+	s.Put(obj)
+}
+
+// add does the actual Add, the object's id lock must be held.
+// Returns the replaced object if any and false if the object is stale.
+// Groups are left for the caller to refresh once the id lock is released
+func (s *Server) add(obj Indexable) (Indexable, bool) {
 	var rmListeners map[*Listener]*Listener
 	var addListeners map[*Listener]*Listener
 
-	s.lock.RLock()
-	curr, found := s.idIdx[obj.ID()]
-	s.lock.RUnlock()
+	s.lock.Lock()
+	if isStale(s.idIdx[obj.ID()], obj) {
+		s.lock.Unlock()
+		atomic.AddUint64(&s.staleWrites, 1)
+		return nil, false
+	}
+	curr, found := s.storeObject(obj)
+	s.lock.Unlock()
 	if found {
 		// collect listeners to remove obj from
 		boxes := s.findBoundingBoxesByObject(curr)
 		rmListeners = collectListeners(boxes)
-		s.tree.Delete(curr)
 	}
-	s.lock.Lock()
-	s.idIdx[obj.ID()] = obj
-	s.lock.Unlock()
 
-	s.tree.Insert(obj)
+	s.replaceInIndex(curr, obj)
+	s.trackVelocity(obj)
+
+	// move the followers' bounds before looking for listeners to notify
+	for _, l := range s.collectFollowers(obj.ID()) {
+		l.followMoved(obj)
+	}
 
 	boxes := s.findBoundingBoxesByObject(obj)
 	addListeners = collectListeners(boxes)
@@ -122,61 +311,159 @@ func (s *Server) Add(obj Indexable) {
 		l.setDirty()
 	}
 
-	s.lock.RLock()
-	lmap, found := s.idSubs[obj.ID()]
-	s.lock.RUnlock()
-	if found {
-		for l := range lmap {
-			l.setDirty()
-		}
+	s.markSubscribersDirty(obj.ID())
+
+	for _, m := range s.collectMonitors() {
+		m.check(obj)
 	}
+
+	return curr, true
 }
 
-// Remove removes a given object from the index and notifies listeners
+// Remove removes an object with the same ID() as a given one from
+// the index and notifies listeners
 func (s *Server) Remove(obj Indexable) {
-	s.lock.RLock()
-	curr, found := s.idIdx[obj.ID()]
-	s.lock.RUnlock()
+	s.RemoveByID(obj.ID())
+}
+
+// RemoveByID removes an object with a given id from the index and notifies
+// listeners. Returns false if there's no such object
+func (s *Server) RemoveByID(id string) bool {
+	start := time.Now()
+	lock := s.idLock(id)
+	lock.Lock()
+	curr, found := s.remove(id)
+	lock.Unlock()
+	if found {
+		s.refreshGroups(curr, nil)
+		// misses remove nothing and are not counted
+		s.getMetrics().observeRemove(start)
+	}
+	return found
+}
+
+// remove does the actual RemoveByID, the object's id lock must be held.
+// Returns the removed object, its group is left for the caller to refresh
+func (s *Server) remove(id string) (Indexable, bool) {
+	s.lock.Lock()
+	curr, found := s.deleteObject(id)
+	s.lock.Unlock()
 	if found {
 		// collect listeners to remove obj from
 		boxes := s.findBoundingBoxesByObject(curr)
 		listeners := collectListeners(boxes)
-		s.tree.Delete(curr)
+		for _, sp := range s.takeEntries(curr) {
+			s.tree.Delete(sp)
+		}
 
 		for l := range listeners {
 			l.setDirty()
 		}
 
-		s.lock.RLock()
-		lmap, found := s.idSubs[obj.ID()]
-		s.lock.RUnlock()
-		if found {
-			for l := range lmap {
-				l.setDirty()
-			}
+		s.markSubscribersDirty(id)
+
+		for _, m := range s.collectMonitors() {
+			m.forget(curr)
 		}
 	}
+	return curr, found
 }
 
-// NewListener creates and returns a new listener
-func (s *Server) NewListener(chSize int, interval time.Duration) *Listener {
-	return newListener(s, chSize, interval)
+// NewListener creates and returns a new listener. The listener is woken up by
+// the server only when it gets dirty, interval limits how often updates are sent
+func (s *Server) NewListener(chSize int, interval time.Duration, opts ...ListenerOption) *Listener {
+	return newListener(s, chSize, interval, opts...)
 }
 
 // SearchIntersect syncronously search for intersections
-// Use this for quick searches if you don't need to subscribe for updates
+// Use this for quick searches if you don't need to subscribe for updates.
+// bb may go beyond the antimeridian
 func (s *Server) SearchIntersect(bb *rtreego.Rect, filters ...rtreego.Filter) map[string]Indexable {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
-
+	defer s.getMetrics().observeSearch(searchOpIntersect, time.Now())
+	// the index has its own locking, holding the server lock
+	// would only block writers for the duration of the search
 	results := make(map[string]Indexable)
-	spatials := s.tree.SearchIntersect(bb, filters...)
-	for _, sp := range spatials {
-		if idxbl, ok := sp.(Indexable); ok {
-			if idxbl.Type() > 0 {
-				results[idxbl.ID()] = idxbl
+	filters = unwrapFilters(filters)
+	for _, rect := range splitRect(bb) {
+		for _, sp := range s.tree.SearchIntersect(rect, filters...) {
+			if idxbl, ok := unwrap(sp).(Indexable); ok {
+				if idxbl.Type() > 0 {
+					results[idxbl.ID()] = idxbl
+				}
 			}
 		}
 	}
 	return results
 }
+
+// NearestNeighbors syncronously searches for up to k objects closest to a given point
+func (s *Server) NearestNeighbors(p rtreego.Point, k int, filters ...rtreego.Filter) []Indexable {
+	defer s.getMetrics().observeSearch(searchOpNearest, time.Now())
+
+	filters = append([]rtreego.Filter{filterObjects}, unwrapFilters(filters)...)
+	n := k
+	if s.hasFragments() {
+		// an object crossing the antimeridian may be found twice
+		n = k * 2
+	}
+	spatials := s.tree.Nearest(p, n, filters...)
+	results := make([]Indexable, 0, len(spatials))
+	seen := make(map[string]bool, len(spatials))
+	for _, sp := range spatials {
+		obj := unwrap(sp).(Indexable)
+		if !seen[obj.ID()] && len(results) < k {
+			seen[obj.ID()] = true
+			results = append(results, obj)
+		}
+	}
+	return results
+}
+
+// Get returns an object by its id
+func (s *Server) Get(id string) (Indexable, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	obj, found := s.idIdx[id]
+	return obj, found
+}
+
+// Has checks if there's an object with a given id
+func (s *Server) Has(id string) bool {
+	_, found := s.Get(id)
+	return found
+}
+
+// Len returns the number of objects
+func (s *Server) Len() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.idIdx)
+}
+
+// LenByType returns the number of objects of a given type
+func (s *Server) LenByType(t IndexableType) int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.counts[t]
+}
+
+// Objects returns all the objects in no particular order
+func (s *Server) Objects() []Indexable {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	objects := make([]Indexable, 0, len(s.idIdx))
+	for _, obj := range s.idIdx {
+		objects = append(objects, obj)
+	}
+	return objects
+}
+
+// Range calls fn for every object until it returns false. Objects are
+// taken at the moment of the call, so fn is free to modify the server
+func (s *Server) Range(fn func(Indexable) bool) {
+	for _, obj := range s.Objects() {
+		if !fn(obj) {
+			return
+		}
+	}
+}
@@ -1,11 +1,22 @@
 package spatial
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/dhconnelly/rtreego"
+	"github.com/viert/spatial/helper"
+	"github.com/viert/spatial/index"
 )
 
 const (
@@ -24,6 +35,10 @@ var (
 	}
 )
 
+var (
+	testRect, _ = testBounds.rect()
+)
+
 type (
 	object struct {
 		id      string
@@ -64,7 +79,7 @@ func timeout(n time.Duration) <-chan time.Time {
 	return t.C
 }
 
-func getUpdates(ch <-chan []Indexable) []Indexable {
+func getUpdates[T any](ch <-chan []T) []T {
 	for {
 		select {
 		case <-timeout(50):
@@ -75,6 +90,16 @@ func getUpdates(ch <-chan []Indexable) []Indexable {
 	}
 }
 
+// getUpdatesOfSize skips updates until one with n objects comes
+func getUpdatesOfSize[T any](ch <-chan []T, n int) []T {
+	for {
+		updates := getUpdates(ch)
+		if updates == nil || len(updates) == n {
+			return updates
+		}
+	}
+}
+
 func eq(a, b float64) bool {
 	tolerance := 0.0001
 	diff := math.Abs(a - b)
@@ -96,7 +121,14 @@ func TestBoundsUpdate(t *testing.T) {
 	lst.SetBounds(testBounds)
 	ch := lst.Updates()
 
-	// make sure there are no updates yet
+	// setting bounds triggers an initial update
+	updates = getUpdates(ch)
+	if updates == nil || len(updates) != 0 {
+		t.Errorf("an empty initial update expected, got %v", updates)
+		return
+	}
+
+	// make sure there are no more updates
 	updates = getUpdates(ch)
 	if updates != nil {
 		t.Errorf("unexpected update: %s", updates)
@@ -187,7 +219,14 @@ func TestWatchID(t *testing.T) {
 
 	ch := lst.Updates()
 
-	// make sure there are no updates yet
+	// setting bounds triggers an initial update
+	updates = getUpdates(ch)
+	if updates == nil || len(updates) != 0 {
+		t.Errorf("an empty initial update expected, got %v", updates)
+		return
+	}
+
+	// make sure there are no more updates
 	updates = getUpdates(ch)
 	if updates != nil {
 		t.Errorf("unexpected update: %s", updates)
@@ -342,3 +381,1209 @@ func TestFilters(t *testing.T) {
 	}
 
 }
+
+type movingObject struct {
+	*object
+	velocity float64
+	heading  float64
+	ts       time.Time
+}
+
+func (m *movingObject) Velocity() float64 {
+	return m.velocity
+}
+
+func (m *movingObject) Heading() float64 {
+	return m.heading
+}
+
+func (m *movingObject) Timestamp() time.Time {
+	return m.ts
+}
+
+func TestSearchIntersectPredicted(t *testing.T) {
+	srv := New(25, 50)
+	srv.SetPredictionHorizon(time.Hour)
+
+	ts := time.Now()
+	obj := &movingObject{
+		object:   newRectObject(itUserObject, testObjectID, helper.SquareCentered(0, 0, 1)),
+		velocity: 600,
+		heading:  0,
+		ts:       ts,
+	}
+	srv.Add(obj)
+
+	// 600 knots to the north for 6 minutes is 60nm which is 1˚ of latitude
+	at := ts.Add(6 * time.Minute)
+	area := helper.SquareCentered(1, 0, 10)
+
+	results := srv.SearchIntersect(area)
+	if len(results) != 0 {
+		t.Errorf("expected no objects at the reported position, got %d", len(results))
+		return
+	}
+
+	results = srv.SearchIntersectPredicted(area, at)
+	if len(results) != 1 {
+		t.Errorf("expected exactly 1 predicted object, got %d", len(results))
+		return
+	}
+
+	predicted, ok := results[testObjectID].(*Predicted)
+	if !ok {
+		t.Errorf("error asserting result type as Predicted")
+		return
+	}
+
+	lat, lng := helper.Center(predicted.Bounds())
+	if !eq(lat, 1) || !eq(lng, 0) {
+		t.Errorf("expected predicted center 1.000/0.000, got %.3f/%.3f", lat, lng)
+	}
+
+	results = srv.SearchIntersectPredicted(helper.SquareCentered(0, 0, 10), at)
+	if len(results) != 0 {
+		t.Errorf("expected no objects at the reported position, got %d", len(results))
+	}
+}
+
+func getProximityEvent(ch <-chan ProximityEvent) *ProximityEvent {
+	select {
+	case <-timeout(50):
+		return nil
+	case ev := <-ch:
+		return &ev
+	}
+}
+
+func TestProximityMonitor(t *testing.T) {
+	srv := New(25, 50)
+	mon := srv.NewProximityMonitor(
+		[]IndexableType{itUserObject},
+		[]IndexableType{itUserObject2},
+		5, 1, 100,
+	)
+	defer mon.Stop()
+	ch := mon.Events()
+
+	srv.Add(newRectObject(itUserObject, "a", helper.SquareCentered(0, 0, 0.1)))
+	srv.Add(newRectObject(itUserObject2, "b", helper.SquareCentered(0, 0.2, 0.1)))
+	if ev := getProximityEvent(ch); ev != nil {
+		t.Errorf("unexpected event: %v", ev)
+		return
+	}
+
+	// 3nm away
+	srv.Add(newRectObject(itUserObject2, "b", helper.SquareCentered(0, 0.05, 0.1)))
+	ev := getProximityEvent(ch)
+	if ev == nil || !ev.Entered {
+		t.Errorf("entering event expected, got %v", ev)
+		return
+	}
+	if ev.A.ID() != "a" || ev.B.ID() != "b" {
+		t.Errorf("expected pair a/b, got %s/%s", ev.A.ID(), ev.B.ID())
+	}
+	if !eq(math.Round(ev.Distance), 3) {
+		t.Errorf("expected distance of 3nm, got %.3f", ev.Distance)
+	}
+
+	// 5.7nm away is within hysteresis
+	srv.Add(newRectObject(itUserObject2, "b", helper.SquareCentered(0, 0.095, 0.1)))
+	if ev := getProximityEvent(ch); ev != nil {
+		t.Errorf("unexpected event: %v", ev)
+		return
+	}
+
+	srv.Add(newRectObject(itUserObject2, "b", helper.SquareCentered(0, 0.2, 0.1)))
+	ev = getProximityEvent(ch)
+	if ev == nil || ev.Entered {
+		t.Errorf("leaving event expected, got %v", ev)
+	}
+}
+
+func TestFollowID(t *testing.T) {
+	srv := New(25, 50)
+	lst := srv.NewListener(100, 10*time.Millisecond)
+	defer lst.Stop()
+	ch := lst.Updates()
+
+	srv.Add(newRectObject(itUserObject, "other", helper.SquareCentered(0, 1.5, 1)))
+	srv.Add(newRectObject(itUserObject, testObjectID, helper.SquareCentered(0, 0, 1)))
+	lst.FollowID(testObjectID, 50)
+
+	updates := getUpdates(ch)
+	if len(updates) != 1 || updates[0].ID() != testObjectID {
+		t.Errorf("expected an update with the followed object only, got %v", updates)
+		return
+	}
+
+	// the other object is 30nm away after the move
+	srv.Add(newRectObject(itUserObject, testObjectID, helper.SquareCentered(0, 1, 1)))
+	updates = getUpdatesOfSize(ch, 2)
+	if len(updates) != 2 {
+		t.Errorf("expected an update with 2 objects, got %v", updates)
+		return
+	}
+
+	lst.Unfollow()
+	srv.Add(newRectObject(itUserObject, testObjectID, helper.SquareCentered(0, 3, 1)))
+	updates = getUpdates(ch)
+	if len(updates) != 1 || updates[0].ID() != "other" {
+		t.Errorf("expected an update with the other object only, got %v", updates)
+	}
+
+	// a write which picked up the follower before Stop moves it afterwards
+	lst.FollowID(testObjectID, 60)
+	lst.Stop()
+	lst.lock.Lock()
+	lst.followID = testObjectID
+	lst.lock.Unlock()
+	obj, _ := srv.Get(testObjectID)
+	lst.followMoved(obj)
+	if n := srv.tree.Len(); n != 2 {
+		t.Errorf("expected no boxes of the stopped listener left, got %d entries", n)
+	}
+}
+
+func TestMapBoundsAround(t *testing.T) {
+	mb := MapBoundsAround(0, 179.5, 60)
+	if mb.SouthWestLng < mb.NorthEastLng {
+		t.Errorf("bounds are expected to wrap around the antimeridian, got %v", mb)
+	}
+	if math.Abs(mb.SouthWestLng-178.5) > 0.01 || math.Abs(mb.NorthEastLng+179.5) > 0.01 {
+		t.Errorf("expected longitudes 178.500/-179.500, got %.3f/%.3f", mb.SouthWestLng, mb.NorthEastLng)
+	}
+}
+
+func TestPolarCorrections(t *testing.T) {
+	pole, _ := rtreego.NewRect(rtreego.Point{89.9, 0}, []float64{0.1, 1})
+	moved := helper.Offset(pole, 60, 90)
+	expanded := helper.Expand(pole, 60)
+	shift := moved.PointCoord(1) - pole.PointCoord(1)
+	if math.IsNaN(shift) || math.IsInf(shift, 0) || !eq(shift, pole.PointCoord(1)-expanded.PointCoord(1)) {
+		t.Errorf("expected Offset and Expand to agree near the pole, got %v and %v", moved, expanded)
+	}
+}
+
+func TestMultipleBounds(t *testing.T) {
+	srv := New(25, 50)
+	lst := srv.NewListener(100, 10*time.Millisecond)
+	defer lst.Stop()
+	ch := lst.Updates()
+
+	handles := lst.SetBoundsMulti([]MapBounds{
+		{SouthWestLng: -10, SouthWestLat: -10, NorthEastLng: 10, NorthEastLat: 10},
+		{SouthWestLng: 5, SouthWestLat: 5, NorthEastLng: 30, NorthEastLat: 30},
+	})
+	second := lst.AddBounds(MapBounds{SouthWestLng: 100, SouthWestLat: 0, NorthEastLng: 110, NorthEastLat: 10})
+
+	srv.Add(newRectObject(itUserObject, "a", helper.SquareCentered(0, 0, 1)))
+	srv.Add(newRectObject(itUserObject, "b", helper.SquareCentered(7, 7, 1)))
+	srv.Add(newRectObject(itUserObject, "c", helper.SquareCentered(5, 105, 1)))
+
+	updates := getUpdatesOfSize(ch, 3)
+	if len(updates) != 3 {
+		t.Errorf("expected 3 deduplicated objects, got %v", updates)
+		return
+	}
+
+	if !lst.RemoveBounds(second) {
+		t.Errorf("area %d is expected to be removed", second)
+	}
+	if lst.RemoveBounds(second) {
+		t.Errorf("area %d is expected to be removed already", second)
+	}
+	lst.RemoveBounds(handles[0])
+
+	updates = getUpdatesOfSize(ch, 1)
+	if len(updates) != 1 || updates[0].ID() != "b" {
+		t.Errorf("expected an update with object b only, got %v", updates)
+	}
+}
+
+func TestBackpressure(t *testing.T) {
+	srv := New(25, 50)
+
+	lst := srv.NewListener(1, 5*time.Millisecond, WithBackpressure(BackpressureDropNewest))
+	for i := 0; i < 3; i++ {
+		lst.ForceUpdate()
+		time.Sleep(20 * time.Millisecond)
+	}
+	if lst.Dropped() != 2 {
+		t.Errorf("expected 2 dropped updates, got %d", lst.Dropped())
+	}
+
+	// a blocked listener must be able to stop
+	lst = srv.NewListener(0, 5*time.Millisecond)
+	lst.ForceUpdate()
+	time.Sleep(20 * time.Millisecond)
+	lst.Stop()
+	if _, ok := <-lst.Updates(); ok {
+		t.Errorf("the update channel is expected to be closed")
+	}
+
+	lst = srv.NewListener(0, 5*time.Millisecond, WithDisconnectTimeout(10*time.Millisecond))
+	lst.ForceUpdate()
+	time.Sleep(50 * time.Millisecond)
+	if lst.Err() != ErrSlowConsumer {
+		t.Errorf("expected ErrSlowConsumer, got %v", lst.Err())
+	}
+	if _, ok := <-lst.Updates(); ok {
+		t.Errorf("the update channel is expected to be closed")
+	}
+}
+
+func TestCallbackListener(t *testing.T) {
+	srv := New(25, 50)
+
+	updates := make(chan []Indexable, 100)
+	calls := 0
+	lst := srv.NewCallbackListener(func(objects []Indexable) {
+		calls++
+		if calls == 1 {
+			panic("first call panics")
+		}
+		updates <- objects
+	}, 10*time.Millisecond)
+	defer lst.Stop()
+	lst.SetBounds(testBounds)
+
+	srv.Add(newObject(itUserObject, testObjectID, 0, 0))
+	time.Sleep(30 * time.Millisecond)
+	if lst.Panics() != 1 {
+		t.Errorf("expected 1 recovered panic, got %d", lst.Panics())
+		return
+	}
+
+	srv.Add(newObject(itUserObject, testObjectID, 1, 1))
+	u := getUpdates(updates)
+	if len(u) != 1 {
+		t.Errorf("expected an update with 1 object, got %v", u)
+	}
+}
+
+func TestEventCallbackListener(t *testing.T) {
+	srv := New(25, 50)
+
+	events := make(chan ListenerEvent, 100)
+	lst := srv.NewEventCallbackListener(func(ev ListenerEvent) {
+		events <- ev
+	}, 10*time.Millisecond)
+	defer lst.Stop()
+	lst.SetBounds(testBounds)
+
+	getEvent := func() *ListenerEvent {
+		select {
+		case <-timeout(50):
+			return nil
+		case ev := <-events:
+			return &ev
+		}
+	}
+
+	srv.Add(newObject(itUserObject, testObjectID, 0, 0))
+	ev := getEvent()
+	if ev == nil || len(ev.Added) != 1 || len(ev.Updated) != 0 || len(ev.Removed) != 0 {
+		t.Errorf("expected an event with one added object, got %v", ev)
+		return
+	}
+
+	srv.Add(newObject(itUserObject, testObjectID, 1, 1))
+	ev = getEvent()
+	if ev == nil || len(ev.Added) != 0 || len(ev.Updated) != 1 || len(ev.Removed) != 0 {
+		t.Errorf("expected an event with one updated object, got %v", ev)
+		return
+	}
+	if ev.Versions[testObjectID] != srv.Version(testObjectID) {
+		t.Errorf("expected the event to carry version %d, got %v", srv.Version(testObjectID), ev.Versions)
+	}
+
+	srv.Add(newObject(itUserObject, testObjectID, 20, 20))
+	ev = getEvent()
+	if ev == nil || len(ev.Added) != 0 || len(ev.Updated) != 0 || len(ev.Removed) != 1 {
+		t.Errorf("expected an event with one removed object, got %v", ev)
+	}
+}
+
+func TestListenerContext(t *testing.T) {
+	srv := New(25, 50)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	lst := srv.NewListenerContext(ctx, 100, 10*time.Millisecond)
+	lst.SetBounds(testBounds)
+	lst.SubscribeID(testObjectID)
+
+	cancel()
+	select {
+	case <-lst.Done():
+	case <-timeout(50):
+		t.Errorf("listener is expected to stop on context cancellation")
+		return
+	}
+
+	if lst.Err() != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", lst.Err())
+	}
+
+	if boxes := srv.tree.SearchIntersect(testRect); len(boxes) != 0 {
+		t.Errorf("expected bounding boxes to be removed, got %d", len(boxes))
+	}
+
+	if len(srv.idSubs[testObjectID]) != 0 {
+		t.Errorf("expected id subscriptions to be removed")
+	}
+}
+
+func benchmarkManyListeners(b *testing.B, n int) {
+	srv := New(25, 50)
+	delivered := make(chan struct{}, 1)
+
+	// listeners are spread over a grid of 1˚ squares
+	for i := 0; i < n; i++ {
+		lat := float64(i%160) - 80
+		lng := float64(i/160%360) - 180
+		lst := srv.NewCallbackListener(func([]Indexable) {
+			select {
+			case delivered <- struct{}{}:
+			default:
+			}
+		}, 0)
+		lst.SetBounds(MapBounds{
+			SouthWestLat: lat,
+			SouthWestLng: lng,
+			NorthEastLat: lat + 1,
+			NorthEastLng: lng + 1,
+		})
+		defer lst.Stop()
+	}
+
+	// idle listeners are not supposed to have goroutines of their own
+	idle := runtime.NumGoroutine()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// one object moving from one listener to another
+		j := i % n
+		lat := float64(j%160) - 79.5
+		lng := float64(j/160%360) - 179.5
+		srv.Add(newRectObject(itUserObject, testObjectID, helper.SquareCentered(lat, lng, 1)))
+		<-delivered
+	}
+	b.ReportMetric(float64(idle), "idle-goroutines")
+}
+
+func BenchmarkListeners100(b *testing.B) {
+	benchmarkManyListeners(b, 100)
+}
+
+func BenchmarkListeners1000(b *testing.B) {
+	benchmarkManyListeners(b, 1000)
+}
+
+func BenchmarkListeners10000(b *testing.B) {
+	benchmarkManyListeners(b, 10000)
+}
+
+func TestListenerSnapshot(t *testing.T) {
+	srv := New(25, 50)
+	srv.Add(newObject(itUserObject, testObjectID, 0, 0))
+	srv.Add(newObject(itUserObject, "obj2", 20, 20))
+
+	lst := srv.NewListener(100, time.Hour)
+	defer lst.Stop()
+
+	lst.SetBounds(testBounds)
+	objects := lst.Snapshot()
+	if len(objects) != 1 || objects[0].ID() != testObjectID {
+		t.Errorf("expected a snapshot with %s only, got %v", testObjectID, objects)
+	}
+
+	// the initial update is not delayed by the interval
+	updates := getUpdates(lst.Updates())
+	if len(updates) != 1 || updates[0].ID() != testObjectID {
+		t.Errorf("expected an initial update with %s only, got %v", testObjectID, updates)
+	}
+}
+
+func TestListenerStats(t *testing.T) {
+	srv := New(25, 50)
+	lst := srv.NewListener(100, 10*time.Millisecond)
+	lst2 := srv.NewListener(100, 10*time.Millisecond)
+	defer lst2.Stop()
+
+	lst.SetBounds(testBounds)
+	lst.SetTypes([]IndexableType{itUserObject})
+	lst.SubscribeID("obj2")
+	srv.Add(newObject(itUserObject, testObjectID, 0, 0))
+	getUpdatesOfSize(lst.Updates(), 1)
+
+	stats := lst.Stats()
+	if stats.UpdatesSent == 0 || stats.ObjectsSent == 0 || stats.DirtyMarks == 0 {
+		t.Errorf("expected non-zero counters, got %+v", stats)
+	}
+	if stats.LastDelivery.IsZero() {
+		t.Errorf("expected last delivery time to be set")
+	}
+	if len(stats.Bounds) != 1 || len(stats.SubscribedIDs) != 1 || stats.SubscribedIDs[0] != "obj2" {
+		t.Errorf("unexpected bounds or subscriptions in %+v", stats)
+	}
+	if stats.Filter != "types [1]" {
+		t.Errorf("unexpected filter description %q", stats.Filter)
+	}
+
+	listeners := srv.Listeners()
+	if len(listeners) != 2 || listeners[0] != lst || listeners[1] != lst2 {
+		t.Errorf("expected 2 listeners in order of creation, got %v", listeners)
+	}
+
+	lst.Stop()
+	if !lst.Stats().Stopped {
+		t.Errorf("listener is expected to be stopped")
+	}
+	if listeners := srv.Listeners(); len(listeners) != 1 {
+		t.Errorf("expected 1 active listener, got %d", len(listeners))
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	srv := New(25, 50)
+	metrics := srv.EnableMetrics()
+
+	lst := srv.NewListener(100, 10*time.Millisecond)
+	defer lst.Stop()
+	lst.SetBounds(testBounds)
+	lst.SubscribeID(testObjectID)
+
+	srv.Add(newObject(itUserObject, testObjectID, 0, 0))
+	srv.Add(newObject(itUserObject2, "obj2", 1, 1))
+	srv.Remove(newObject(itUserObject2, "obj2", 1, 1))
+	// misses are not counted
+	srv.RemoveByID("missing")
+	srv.SearchIntersect(testRect)
+	getUpdatesOfSize(lst.Updates(), 1)
+
+	var buf bytes.Buffer
+	if _, err := metrics.WriteTo(&buf); err != nil {
+		t.Errorf("error writing metrics: %s", err)
+		return
+	}
+	output := buf.String()
+
+	for _, line := range []string{
+		"spatial_objects{type=\"1\"} 1",
+		"spatial_adds_total 2",
+		"spatial_removes_total 1",
+		"spatial_add_duration_seconds_count 2",
+		"spatial_search_duration_seconds_count{op=\"intersect\"} 1",
+		"spatial_listeners 1",
+		"spatial_id_subscriptions 1",
+		"spatial_tree_entries 2",
+	} {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("metrics are expected to contain %q", line)
+		}
+	}
+}
+
+func TestAlternativeIndex(t *testing.T) {
+	world, _ := rtreego.NewRect(rtreego.Point{-90, -180}, []float64{180, 360})
+	for name, idx := range map[string]index.Index{
+		"grid":     index.NewGrid(1),
+		"quadtree": index.NewQuadtree(world, 8, 16),
+		"geohash":  index.NewGeohash(6),
+		"cow":      index.NewCOW(25, 50, 64),
+	} {
+		srv := NewWithIndex(idx)
+		lst := srv.NewListener(100, 10*time.Millisecond)
+		lst.SetBounds(testBounds)
+
+		srv.Add(newRectObject(itUserObject, testObjectID, helper.SquareCentered(0, 0, 1)))
+		srv.Add(newRectObject(itUserObject, "obj2", helper.SquareCentered(5, 5, 1)))
+		if updates := getUpdatesOfSize(lst.Updates(), 2); updates == nil {
+			t.Errorf("%s: expected an update with 2 objects", name)
+		}
+
+		nearest := srv.NearestNeighbors(rtreego.Point{4, 4}, 1)
+		if len(nearest) != 1 || nearest[0].ID() != "obj2" {
+			t.Errorf("%s: expected obj2 to be the nearest, got %v", name, nearest)
+		}
+		lst.Stop()
+	}
+}
+
+func TestBulkLoad(t *testing.T) {
+	for name, srv := range map[string]*Server{
+		"rtree":   New(25, 50),
+		"sharded": NewSharded(4, 8, 25, 50),
+		"cow":     NewCOW(25, 50, 64),
+	} {
+		srv.Add(newObject(itUserObject, "stale", 1, 1))
+		lst := srv.NewListener(100, 10*time.Millisecond)
+		lst.SetBounds(testBounds)
+		if updates := getUpdatesOfSize(lst.Updates(), 1); updates == nil {
+			t.Errorf("%s: expected an update with the stale object", name)
+		}
+
+		objs := make([]Indexable, 0, 1000)
+		for i := 0; i < 1000; i++ {
+			objs = append(objs, newObject(itUserObject, fmt.Sprintf("obj%d", i), float64(i%40)-20, float64(i/40)-12))
+		}
+		srv.BulkLoad(objs)
+
+		if _, found := srv.SearchIntersect(helper.SquareCentered(1, 1, 0.1))["stale"]; found {
+			t.Errorf("%s: stale object is expected to be replaced", name)
+		}
+		// listener areas survive bulk loading
+		expected := len(srv.SearchIntersect(testRect))
+		if updates := getUpdatesOfSize(lst.Updates(), expected); updates == nil {
+			t.Errorf("%s: expected an update with %d objects", name, expected)
+		}
+
+		// objects are indexed by id, so updates replace them
+		srv.Add(newObject(itUserObject, "obj0", 50, 50))
+		if res := srv.SearchIntersect(helper.SquareCentered(-20, -12, 0.1)); len(res) != 0 {
+			t.Errorf("%s: expected obj0 to be moved, got %v", name, res)
+		}
+		if res := srv.SearchIntersect(helper.SquareCentered(50, 50, 0.1)); len(res) != 1 {
+			t.Errorf("%s: expected obj0 to be found at its new position, got %v", name, res)
+		}
+		lst.Stop()
+	}
+}
+
+func TestTypedServer(t *testing.T) {
+	srv := NewTyped[*object](25, 50)
+	// objects of other types are skipped by typed searches
+	srv.Server().Add(NewObject("untyped", itUserObject, helper.SquareCentered(0, 0, 1), 42, nil))
+
+	lst := srv.NewListener(100, 10*time.Millisecond)
+	defer lst.Stop()
+	if cap(lst.Updates()) != 100 {
+		t.Errorf("expected the typed channel size to be 100, got %d", cap(lst.Updates()))
+	}
+	lst.SetBounds(testBounds)
+
+	srv.Add(newObject(itUserObject, testObjectID, 0, 0))
+	srv.Add(newObject(itUserObject, "obj2", 20, 20))
+
+	obj, found := srv.Get(testObjectID)
+	if !found || obj.id != testObjectID {
+		t.Errorf("expected to get %s, got %v", testObjectID, obj)
+	}
+	if _, found := srv.Get("untyped"); found {
+		t.Error("untyped object is not expected to be found")
+	}
+
+	res := srv.Search(testRect)
+	if len(res) != 1 || res[0].id != testObjectID {
+		t.Errorf("expected to find %s only, got %v", testObjectID, res)
+	}
+	nearest := srv.NearestNeighbors(rtreego.Point{0, 0}, 1)
+	if len(nearest) != 1 || nearest[0].id != testObjectID {
+		t.Errorf("expected %s to be the nearest, got %v", testObjectID, nearest)
+	}
+
+	updates := getUpdatesOfSize(lst.Updates(), 1)
+	if updates == nil || updates[0].id != testObjectID {
+		t.Errorf("expected an update with %s, got %v", testObjectID, updates)
+	}
+
+	if ref, ok := RefOf[int](srv.Server().SearchIntersect(testRect)["untyped"]); !ok || ref != 42 {
+		t.Errorf("expected ref to be 42, got %v", ref)
+	}
+}
+
+func TestAccessors(t *testing.T) {
+	srv := New(25, 50)
+	srv.Add(newObject(itUserObject, testObjectID, 0, 0))
+	srv.Add(newObject(itUserObject, "obj2", 1, 1))
+	srv.Add(newObject(itUserObject2, "obj3", 2, 2))
+	// replacing an object with an object of another type
+	srv.Add(newObject(itUserObject2, "obj2", 1, 1))
+
+	if obj, found := srv.Get(testObjectID); !found || obj.ID() != testObjectID {
+		t.Errorf("expected to get %s, got %v", testObjectID, obj)
+	}
+	if srv.Len() != 3 {
+		t.Errorf("expected 3 objects, got %d", srv.Len())
+	}
+	if n := srv.LenByType(itUserObject); n != 1 {
+		t.Errorf("expected 1 object of type %d, got %d", itUserObject, n)
+	}
+	if n := srv.LenByType(itUserObject2); n != 2 {
+		t.Errorf("expected 2 objects of type %d, got %d", itUserObject2, n)
+	}
+
+	srv.Remove(newObject(itUserObject, testObjectID, 0, 0))
+	if srv.Has(testObjectID) {
+		t.Errorf("%s is expected to be removed", testObjectID)
+	}
+	if n := srv.LenByType(itUserObject); n != 0 {
+		t.Errorf("expected no objects of type %d, got %d", itUserObject, n)
+	}
+
+	visited := 0
+	srv.Range(func(obj Indexable) bool {
+		visited++
+		// modifying the server while ranging must not deadlock
+		srv.Remove(obj)
+		return true
+	})
+	if visited != 2 || srv.Len() != 0 || len(srv.Objects()) != 0 {
+		t.Errorf("expected 2 objects visited and removed, visited %d, %d left", visited, srv.Len())
+	}
+
+	// counts of types with no objects left are dropped either way
+	srv.Add(newObject(itUserObject, testObjectID, 0, 0))
+	srv.Add(newObject(itUserObject2, testObjectID, 0, 0))
+	if _, found := srv.counts[itUserObject]; found || len(srv.counts) != 1 {
+		t.Errorf("expected only a count of type %d, got %v", itUserObject2, srv.counts)
+	}
+}
+
+func TestConditionalWrites(t *testing.T) {
+	srv := New(25, 50)
+	metrics := srv.EnableMetrics()
+	obj := newObject(itUserObject, testObjectID, 0, 0)
+
+	var wg sync.WaitGroup
+	var added int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if srv.AddIfAbsent(newObject(itUserObject, testObjectID, 0, 0)) {
+				atomic.AddInt32(&added, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if added != 1 {
+		t.Errorf("expected the object to be added once, got %d", added)
+	}
+	// failed conditional writes are not counted as adds
+	if adds := atomic.LoadUint64(&metrics.adds); adds != 1 {
+		t.Errorf("expected 1 add in metrics, got %d", adds)
+	}
+	if n := srv.tree.Len(); n != 1 {
+		t.Errorf("expected 1 object in the index, got %d", n)
+	}
+
+	version := srv.Version(testObjectID)
+	if !srv.UpdateIfVersion(obj, version) {
+		t.Error("expected the object to be updated")
+	}
+	if srv.UpdateIfVersion(obj, version) {
+		t.Error("expected the update with an outdated version to fail")
+	}
+	if srv.Version(testObjectID) <= version {
+		t.Error("expected the version to grow")
+	}
+
+	moved := newObject(itUserObject, testObjectID, 5, 5)
+	if srv.CompareAndSwap(newObject(itUserObject, testObjectID, 0, 0), moved) {
+		t.Error("expected swapping a stale object to fail")
+	}
+	if !srv.CompareAndSwap(obj, moved) {
+		t.Error("expected the object to be swapped")
+	}
+	if curr, _ := srv.Get(testObjectID); curr != moved {
+		t.Errorf("expected the current object to be the moved one, got %v", curr)
+	}
+
+	if !srv.RemoveByID(testObjectID) {
+		t.Error("expected the object to be removed")
+	}
+	if srv.RemoveByID(testObjectID) || srv.Version(testObjectID) != 0 {
+		t.Error("expected the object to be removed already")
+	}
+	if n := srv.tree.Len(); n != 0 {
+		t.Errorf("expected the index to be empty, got %d objects", n)
+	}
+}
+
+type versionedObject struct {
+	*object
+	version uint64
+}
+
+func (v *versionedObject) Version() uint64 {
+	return v.version
+}
+
+func TestVersioned(t *testing.T) {
+	srv := New(25, 50)
+	srv.Add(&versionedObject{newObject(itUserObject, testObjectID, 0, 0), 2})
+	// an out-of-order report
+	srv.Add(&versionedObject{newObject(itUserObject, testObjectID, 5, 5), 1})
+
+	obj, _ := srv.Get(testObjectID)
+	if v := obj.(Versioned).Version(); v != 2 {
+		t.Errorf("expected the newer object to be kept, got version %d", v)
+	}
+	if srv.StaleWrites() != 1 {
+		t.Errorf("expected 1 stale write, got %d", srv.StaleWrites())
+	}
+	if srv.UpdateIfVersion(&versionedObject{newObject(itUserObject, testObjectID, 5, 5), 1}, srv.Version(testObjectID)) {
+		t.Error("expected a conditional write of a stale object to fail")
+	}
+
+	// a duplicate report
+	if err := srv.Put(&versionedObject{newObject(itUserObject, testObjectID, 5, 5), 2}); !errors.Is(err, ErrStaleObject) {
+		t.Errorf("expected an object with the same version to be stale, got %v", err)
+	}
+
+	lst := srv.NewVersionedListener(100, 10*time.Millisecond)
+	defer lst.Stop()
+	lst.SetBounds(testBounds)
+	<-lst.Updates()
+
+	srv.Add(&versionedObject{newObject(itUserObject, testObjectID, 5, 5), 3})
+	if res := srv.SearchIntersect(helper.SquareCentered(5, 5, 0.1)); len(res) != 1 {
+		t.Errorf("expected the newer object to be indexed, got %v", res)
+	}
+
+	var update VersionedUpdate
+	select {
+	case update = <-lst.Updates():
+	case <-timeout(100):
+	}
+	if len(update.Objects) != 1 || update.Versions[testObjectID] != srv.Version(testObjectID) {
+		t.Errorf("expected the update to carry the object version, got %v", update)
+	}
+}
+
+func TestUpdateMeta(t *testing.T) {
+	srv := New(25, 50)
+	obj := NewObject(testObjectID, itUserObject, helper.SquareCentered(0, 0, 1), nil, map[string]string{"status": "taxi"})
+	srv.Add(obj)
+
+	events := make(chan ListenerEvent, 100)
+	lst := srv.NewEventCallbackListener(func(ev ListenerEvent) {
+		events <- ev
+	}, 10*time.Millisecond)
+	defer lst.Stop()
+	lst.SetBounds(testBounds)
+
+	select {
+	case <-events:
+	case <-timeout(100):
+		t.Fatal("expected an initial event")
+	}
+
+	version := srv.Version(testObjectID)
+	if !srv.UpdateMeta(testObjectID, map[string]string{"status": "airborne", "squawk": "7000"}) {
+		t.Fatal("expected meta to be updated")
+	}
+	if obj.Meta("status") != "airborne" || obj.Meta("squawk") != "7000" {
+		t.Errorf("expected meta to be patched in place, got %v", obj.MetaMap())
+	}
+	if srv.Version(testObjectID) <= version {
+		t.Error("expected the version to grow")
+	}
+
+	select {
+	case ev := <-events:
+		if len(ev.Updated) != 1 || ev.Versions[testObjectID] != srv.Version(testObjectID) {
+			t.Errorf("expected an event with the updated object, got %v", ev)
+		}
+	case <-timeout(100):
+		t.Error("expected an event after meta update")
+	}
+
+	if !srv.DeleteMetaKey(testObjectID, "squawk") || obj.HasMetaKey("squawk") {
+		t.Error("expected the meta key to be deleted")
+	}
+	if srv.UpdateMeta("missing", map[string]string{"status": "airborne"}) {
+		t.Error("expected meta update of a missing object to fail")
+	}
+}
+
+func TestAttrs(t *testing.T) {
+	srv := New(25, 50)
+	seen := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	srv.Add(NewObject("low", itUserObject, helper.SquareCentered(0, 0, 1), nil, nil).WithAttrs(map[string]Attr{
+		"alt":      IntAttr(5000),
+		"speed":    FloatAttr(180.5),
+		"airborne": BoolAttr(true),
+		"callsign": StringAttr("AFL123"),
+		"seen":     TimeAttr(seen),
+	}))
+	srv.Add(NewObject("high", itUserObject, helper.SquareCentered(1, 1, 1), nil, nil).WithAttrs(map[string]Attr{
+		"alt": FloatAttr(15000),
+	}))
+	srv.Add(NewObject("noalt", itUserObject, helper.SquareCentered(2, 2, 1), nil, nil))
+
+	res := srv.SearchIntersect(testRect, FilterByAttrRange("alt", 10000, 20000))
+	if _, found := res["high"]; len(res) != 1 || !found {
+		t.Errorf("expected high to be found only, got %v", res)
+	}
+
+	obj, _ := srv.Get("low")
+	attr, _ := obj.(Attributed).Attr("alt")
+	if v, ok := attr.AsInt(); !ok || v != 5000 {
+		t.Errorf("expected alt to be 5000, got %v", attr)
+	}
+	if _, ok := attr.AsString(); ok {
+		t.Error("int attr is not expected to be a string")
+	}
+
+	srv.UpdateAttrs("low", map[string]Attr{"alt": IntAttr(12000)})
+	if res := srv.SearchIntersect(testRect, FilterByAttrRange("alt", 10000, 20000)); len(res) != 2 {
+		t.Errorf("expected 2 objects after the attr update, got %v", res)
+	}
+
+	data, err := json.Marshal(obj.(*Object).Attrs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var attrs map[string]Attr
+	if err := json.Unmarshal(data, &attrs); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := attrs["seen"].AsTime(); !ok || !v.Equal(seen) {
+		t.Errorf("expected seen to survive json round trip, got %v", attrs["seen"])
+	}
+	if v, ok := attrs["airborne"].AsBool(); !ok || !v {
+		t.Errorf("expected airborne to survive json round trip, got %v", attrs["airborne"])
+	}
+	if v, ok := attrs["alt"].AsInt(); !ok || v != 12000 {
+		t.Errorf("expected alt to survive json round trip, got %v", attrs["alt"])
+	}
+}
+
+func TestMetaIndex(t *testing.T) {
+	srv := New(25, 50)
+	for i := 0; i < 100; i++ {
+		callsign := fmt.Sprintf("SVR%d", i)
+		if i%10 == 0 {
+			callsign = fmt.Sprintf("AFL%d", i)
+		}
+		srv.Add(NewObject(fmt.Sprintf("obj%d", i), itUserObject, helper.SquareCentered(float64(i%10), float64(i/10), 0.1), nil,
+			map[string]string{"callsign": callsign}))
+	}
+
+	// without an index meta lookups fall back to scans
+	if res := srv.FindByMetaPrefix("callsign", "AFL"); len(res) != 10 {
+		t.Errorf("expected 10 objects found by scan, got %d", len(res))
+	}
+
+	srv.AddMetaIndex("callsign", MetaIndexSorted)
+	if res := srv.FindByMetaPrefix("callsign", "AFL"); len(res) != 10 {
+		t.Errorf("expected 10 objects found by prefix, got %d", len(res))
+	}
+	if res := srv.FindByMeta("callsign", "AFL50"); len(res) != 1 || res[0].ID() != "obj50" {
+		t.Errorf("expected obj50 to be found, got %v", res)
+	}
+
+	world, _ := rtreego.NewRect(rtreego.Point{-90, -180}, []float64{180, 360})
+	q := Query{Bounds: world, MetaKey: "callsign", MetaValue: "AFL", MetaPrefix: true}
+	if plan, _ := srv.plan(&q); plan != planMetaIndex {
+		t.Errorf("expected a selective meta condition to use the index, got plan %d", plan)
+	}
+	if res := srv.Query(q); len(res) != 10 {
+		t.Errorf("expected 10 objects found by query, got %d", len(res))
+	}
+	q = Query{Bounds: helper.SquareCentered(1, 0, 0.1), MetaKey: "callsign", MetaValue: "SVR", MetaPrefix: true}
+	if plan, _ := srv.plan(&q); plan != planTree {
+		t.Errorf("expected a small area to be searched in the tree, got plan %d", plan)
+	}
+	if res := srv.Query(q); len(res) != 1 || res[0].ID() != "obj1" {
+		t.Errorf("expected obj1 to be found by query, got %v", res)
+	}
+
+	srv.UpdateMeta("obj50", map[string]string{"callsign": "SVR50"})
+	srv.RemoveByID("obj60")
+	if res := srv.FindByMetaPrefix("callsign", "AFL"); len(res) != 8 {
+		t.Errorf("expected 8 objects after update and removal, got %d", len(res))
+	}
+}
+
+func TestGroups(t *testing.T) {
+	srv := New(25, 50)
+	srv.Add(NewObject("truck1", itUserObject, helper.SquareCentered(0, 0, 1), nil, nil).WithParent("convoy"))
+	srv.Add(NewObject("truck2", itUserObject, helper.SquareCentered(2, 2, 1), nil, nil).WithParent("convoy"))
+	srv.Add(newObject(itUserObject, "loner", 5, 5))
+
+	obj, found := srv.Get("convoy")
+	if !found {
+		t.Fatal("expected the group to be created")
+	}
+	group := obj.(*Group)
+	if members := group.Members(); len(members) != 2 || members[0] != "truck1" || members[1] != "truck2" {
+		t.Errorf("expected trucks to be the group members, got %v", members)
+	}
+	truck1, _ := srv.Get("truck1")
+	truck2, _ := srv.Get("truck2")
+	if !checkCoords(group.Bounds(), truck1.Bounds().PointCoord(0), truck1.Bounds().PointCoord(1)) ||
+		!eq(group.Bounds().LengthsCoord(0), truck2.Bounds().PointCoord(0)+truck2.Bounds().LengthsCoord(0)-truck1.Bounds().PointCoord(0)) {
+		t.Errorf("expected the group bounds to be the union of the members' bounds, got %v", group.Bounds())
+	}
+
+	groups := srv.NewListener(100, 10*time.Millisecond)
+	defer groups.Stop()
+	groups.SetGroupMode(GroupModeGroups)
+	groups.SetBounds(testBounds)
+	members := srv.NewListener(100, 10*time.Millisecond)
+	defer members.Stop()
+	members.SetGroupMode(GroupModeMembers)
+	members.SetBounds(testBounds)
+
+	if updates := getUpdatesOfSize(groups.Updates(), 2); updates == nil {
+		t.Error("expected an update with the group and the loner")
+	}
+	if updates := getUpdatesOfSize(members.Updates(), 3); updates == nil {
+		t.Error("expected an update with the trucks and the loner")
+	}
+
+	// the group follows its members
+	srv.Add(NewObject("truck2", itUserObject, helper.SquareCentered(30, 30, 1), nil, nil).WithParent("convoy"))
+	if res := srv.SearchIntersect(helper.SquareCentered(20, 20, 1)); len(res) != 1 {
+		t.Errorf("expected the group to cover the area between the trucks, got %v", res)
+	}
+
+	srv.RemoveByID("truck1")
+	srv.RemoveByID("truck2")
+	if srv.Has("convoy") {
+		t.Error("expected the group to be removed with its last member")
+	}
+}
+
+func TestValidation(t *testing.T) {
+	srv := New(25, 50)
+
+	nan, _ := rtreego.NewRect(rtreego.Point{math.NaN(), 0}, []float64{1, 1})
+	outside, _ := rtreego.NewRect(rtreego.Point{89.5, 0}, []float64{1, 1})
+	for name, tc := range map[string]struct {
+		rect *rtreego.Rect
+		err  error
+	}{
+		"nan":     {nan, ErrNaNCoordinate},
+		"outside": {outside, ErrLatitudeOutOfRange},
+		"nil":     {nil, ErrInvalidBounds},
+	} {
+		err := srv.Put(newRectObject(itUserObject, name, tc.rect))
+		if !errors.Is(err, tc.err) || !errors.Is(err, ErrInvalidBounds) {
+			t.Errorf("%s: expected %v, got %v", name, tc.err, err)
+		}
+		if srv.Has(name) {
+			t.Errorf("%s: invalid object is not expected to be added", name)
+		}
+	}
+
+	// longitudes of Object are normalized
+	obj := NewObject(testObjectID, itUserObject, helper.SquareCentered(0, 360, 1), nil, nil)
+	if err := srv.Put(obj); err != nil {
+		t.Errorf("expected the object to be normalized, got %v", err)
+	}
+	if res := srv.SearchIntersect(helper.SquareCentered(0, 0, 0.1)); len(res) != 1 {
+		t.Errorf("expected the object to be found near 0, 0, got %v", res)
+	}
+
+	if _, err := NewMapBounds(10, 10, -10, 20); !errors.Is(err, ErrInvertedBounds) {
+		t.Errorf("expected inverted bounds error, got %v", err)
+	}
+	if _, err := NewMapBounds(-100, 10, 10, 20); !errors.Is(err, ErrLatitudeOutOfRange) {
+		t.Errorf("expected latitude out of range error, got %v", err)
+	}
+	mb, err := NewMapBounds(-10, 350, 10, 370)
+	if err != nil || !eq(mb.SouthWestLng, -10) || !eq(mb.NorthEastLng, 10) {
+		t.Errorf("expected longitudes to be normalized, got %v, %v", mb, err)
+	}
+	if err := (&MapBounds{SouthWestLat: math.NaN()}).Validate(); !errors.Is(err, ErrNaNCoordinate) {
+		t.Errorf("expected NaN coordinate error, got %v", err)
+	}
+
+	// other Indexables are never modified
+	shifted := helper.SquareCentered(0, 360, 1)
+	if err := srv.Put(newRectObject(itUserObject, "shifted", shifted)); err != nil {
+		t.Errorf("expected shifted bounds to be normalized, got %v", err)
+	}
+	if res := srv.SearchIntersect(helper.SquareCentered(0, 0, 0.1)); len(res) != 2 {
+		t.Errorf("expected the shifted object to be found near 0, 0, got %v", res)
+	}
+	if curr, _ := srv.Get("shifted"); curr.Bounds() != shifted {
+		t.Error("expected the shifted object to be stored as is")
+	}
+	if n := srv.InvalidWrites(); n != 3 {
+		t.Errorf("expected 3 invalid writes, got %d", n)
+	}
+	if err := srv.Put(newRectObject(itUserObject, "shifted", NormalizeRect(shifted))); err != nil {
+		t.Errorf("expected normalized bounds to be valid, got %v", err)
+	}
+
+	// zero sizes are rejected the same way
+	if _, err := NewMapBounds(10, 10, 10, 20); !errors.Is(err, ErrInvertedBounds) {
+		t.Errorf("expected zero latitude size to be rejected, got %v", err)
+	}
+	if _, err := NewMapBounds(10, 10, 20, 10); !errors.Is(err, ErrInvertedBounds) {
+		t.Errorf("expected zero longitude size to be rejected, got %v", err)
+	}
+	if _, err := NewMapBounds(-10, 170, 10, -170); err != nil {
+		t.Errorf("expected bounds crossing the antimeridian to be valid, got %v", err)
+	}
+}
+
+func TestAntimeridian(t *testing.T) {
+	srv := New(25, 50)
+	lst := srv.NewListener(100, 10*time.Millisecond)
+	defer lst.Stop()
+	lst.SetBounds(MapBounds{SouthWestLat: -10, SouthWestLng: -179, NorthEastLat: 10, NorthEastLng: -170})
+	ch := lst.Updates()
+	getUpdates(ch)
+
+	// 170..190 crosses the antimeridian and gets indexed in two parts
+	bounds, _ := rtreego.NewRect(rtreego.Point{-1, 170}, []float64{2, 20})
+	obj := newRectObject(itUserObject, testObjectID, bounds)
+	if err := srv.Put(obj); err != nil {
+		t.Fatalf("expected the object to be added, got %v", err)
+	}
+	if srv.tree.Len() != 3 {
+		t.Errorf("expected 2 fragments and a listener box in the index, got %d", srv.tree.Len())
+	}
+
+	if updates := getUpdatesOfSize(ch, 1); len(updates) != 1 || updates[0] != Indexable(obj) {
+		t.Errorf("expected the object in the listener update, got %v", updates)
+	}
+	for _, lng := range []float64{175, -175} {
+		res := srv.SearchIntersect(helper.SquareCentered(0, lng, 1))
+		if len(res) != 1 || res[testObjectID] != Indexable(obj) {
+			t.Errorf("expected the object to be found near %v, got %v", lng, res)
+		}
+	}
+	// a query going beyond 180 as well
+	res := srv.SearchIntersect(bounds)
+	if len(res) != 1 {
+		t.Errorf("expected one object, got %v", res)
+	}
+
+	// queries lying beyond the range entirely find only what they cover
+	srv.Add(newRectObject(itUserObject2, "east", helper.SquareCentered(0, -170, 1)))
+	srv.Add(newRectObject(itUserObject2, "west", helper.SquareCentered(0, 165, 1)))
+	srv.Add(newRectObject(itUserObject2, "far", helper.SquareCentered(0, 0, 1)))
+	above, _ := rtreego.NewRect(rtreego.Point{-1, 185}, []float64{2, 10})
+	if res := srv.SearchIntersect(above); len(res) != 2 || res["east"] == nil || res[testObjectID] == nil {
+		t.Errorf("expected the object and east to be found above 180, got %v", res)
+	}
+	below, _ := rtreego.NewRect(rtreego.Point{-1, -200}, []float64{2, 15})
+	if res := srv.SearchIntersect(below); len(res) != 2 || res["west"] == nil || res[testObjectID] == nil {
+		t.Errorf("expected the object and west to be found below -180, got %v", res)
+	}
+	if res := srv.Query(Query{Bounds: above}); len(res) != 2 {
+		t.Errorf("expected 2 objects found by a query above 180, got %v", res)
+	}
+	for _, id := range []string{"east", "west", "far"} {
+		srv.RemoveByID(id)
+	}
+	if nn := srv.NearestNeighbors(rtreego.Point{0, 180}, 5); len(nn) != 1 || nn[0] != Indexable(obj) {
+		t.Errorf("expected the object to be found once, got %v", nn)
+	}
+
+	srv.Remove(obj)
+	if updates := getUpdatesOfSize(ch, 0); updates == nil {
+		t.Errorf("expected the object to be removed from the listener")
+	}
+	if srv.tree.Len() != 1 {
+		t.Errorf("expected fragments to be removed, got %d entries", srv.tree.Len())
+	}
+
+	srv.BulkLoad([]Indexable{obj})
+	if res := srv.SearchIntersect(helper.SquareCentered(0, -175, 1)); len(res) != 1 {
+		t.Errorf("expected the bulk loaded object to be found, got %v", res)
+	}
+}
+
+func TestProximityMonitorDropped(t *testing.T) {
+	srv := New(25, 50)
+	mon := srv.NewProximityMonitor([]IndexableType{itUserObject}, []IndexableType{itUserObject2}, 5, 1, 1)
+	defer mon.Stop()
+
+	// nobody reads events, writes must not block
+	srv.Add(newRectObject(itUserObject, "a", helper.SquareCentered(0, 0, 0.1)))
+	srv.Add(newRectObject(itUserObject2, "b", helper.SquareCentered(0, 0.01, 0.1)))
+	srv.Add(newRectObject(itUserObject2, "c", helper.SquareCentered(0, 0.01, 0.1)))
+	if mon.Dropped() != 1 {
+		t.Errorf("expected 1 dropped event, got %d", mon.Dropped())
+	}
+	if ev := <-mon.Events(); !ev.Entered {
+		t.Errorf("expected an entered event, got %v", ev)
+	}
+
+	// the dropped transition is detected again
+	srv.Add(newRectObject(itUserObject2, "c", helper.SquareCentered(0, 0.02, 0.1)))
+	if ev := <-mon.Events(); !ev.Entered || ev.B.ID() != "c" {
+		t.Errorf("expected c to enter, got %v", ev)
+	}
+}
+
+func TestGroupsConcurrentWrites(t *testing.T) {
+	srv := New(25, 50)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("truck%d", i)
+			for j := 0; j < 100; j++ {
+				srv.Add(NewObject(id, itUserObject, helper.SquareCentered(float64(j%10), float64(i), 1), nil, nil).WithParent("convoy"))
+				if j%3 == 0 {
+					srv.RemoveByID(id)
+				}
+			}
+			srv.RemoveByID(id)
+		}(i)
+	}
+	// writes to the group id race with group rebuilds
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 100; j++ {
+			srv.RemoveByID("convoy")
+		}
+	}()
+	wg.Wait()
+
+	srv.RemoveByID("convoy")
+	if srv.Len() != 0 || srv.tree.Len() != 0 || len(srv.versions) != 0 {
+		t.Errorf("expected no objects left, got %d in the id index, %d in the tree", srv.Len(), srv.tree.Len())
+	}
+}
+
+func TestTypedListenerPrediction(t *testing.T) {
+	srv := NewTyped[*movingObject](25, 50)
+	lst := srv.NewListener(100, 10*time.Millisecond)
+	defer lst.Stop()
+	lst.SetPrediction(true)
+	lst.SetBounds(testBounds)
+
+	obj := &movingObject{
+		object:   newRectObject(itUserObject, testObjectID, helper.SquareCentered(0, 0, 1)),
+		velocity: 1,
+		ts:       time.Now(),
+	}
+	srv.Add(obj)
+
+	// moving objects come wrapped into Predicted and are unwrapped
+	if updates := getUpdatesOfSize(lst.Updates(), 1); len(updates) != 1 || updates[0] != obj {
+		t.Errorf("expected the moving object in the update, got %v", updates)
+	}
+}
+
+func TestGroupAcrossAntimeridian(t *testing.T) {
+	srv := New(25, 50)
+	srv.Add(NewObject("ship1", itUserObject, helper.SquareCentered(0, 179.9, 1), nil, nil).WithParent("fleet"))
+	srv.Add(NewObject("ship2", itUserObject, helper.SquareCentered(0, -179.9, 1), nil, nil).WithParent("fleet"))
+
+	obj, _ := srv.Get("fleet")
+	if lng := obj.Bounds().LengthsCoord(1); lng > 1 {
+		t.Errorf("expected the group to cross the antimeridian, got %v", obj.Bounds())
+	}
+	if res := srv.SearchIntersect(helper.SquareCentered(0, 0, 1)); len(res) != 0 {
+		t.Errorf("expected nothing to be found far from the fleet, got %v", res)
+	}
+	for _, lng := range []float64{179.9, -179.9} {
+		if res := srv.SearchIntersect(helper.SquareCentered(0, lng, 1)); res["fleet"] == nil {
+			t.Errorf("expected the fleet to be found near %v, got %v", lng, res)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package spatial
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	listenerAutoID uint64 = 0
+)
+
+// ListenerStats is a point-in-time description of a listener
+type ListenerStats struct {
+	ID                  string
+	UpdatesSent         uint64
+	ObjectsSent         uint64
+	AvgObjectsPerUpdate float64
+	DirtyMarks          uint64
+	Dropped             uint64
+	Panics              uint64
+	LastDelivery        time.Time
+	UpdateInterval      time.Duration
+	Bounds              map[BoundsHandle]MapBounds
+	SubscribedIDs       []string
+	FollowedID          string
+	Filter              string
+	Predicted           bool
+	Callback            bool
+	Stopped             bool
+	Err                 error
+}
+
+// ID returns the listener's unique identifier
+func (l *Listener) ID() string {
+	return fmt.Sprintf("lst:%d", l.seq)
+}
+
+func (l *Listener) recordSent(n int) {
+	atomic.AddUint64(&l.updatesSent, 1)
+	atomic.AddUint64(&l.objectsSent, uint64(n))
+	atomic.StoreInt64(&l.lastSent, time.Now().UnixNano())
+}
+
+// describeFilter returns a human-readable description of the listener's filter
+func (l *Listener) describeFilter() string {
+	if len(l.types) == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("types %v", l.types)
+}
+
+// Stats returns the listener's statistics and current settings
+func (l *Listener) Stats() ListenerStats {
+	stats := ListenerStats{
+		ID:             l.ID(),
+		UpdatesSent:    atomic.LoadUint64(&l.updatesSent),
+		ObjectsSent:    atomic.LoadUint64(&l.objectsSent),
+		DirtyMarks:     atomic.LoadUint64(&l.dirtyMarks),
+		Dropped:        l.Dropped(),
+		Panics:         l.Panics(),
+		UpdateInterval: l.updateInterval,
+		Callback:       l.callback != nil,
+	}
+	if stats.UpdatesSent > 0 {
+		stats.AvgObjectsPerUpdate = float64(stats.ObjectsSent) / float64(stats.UpdatesSent)
+	}
+	if ts := atomic.LoadInt64(&l.lastSent); ts > 0 {
+		stats.LastDelivery = time.Unix(0, ts)
+	}
+
+	select {
+	case <-l.done:
+		stats.Stopped = true
+	default:
+	}
+
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	stats.Bounds = make(map[BoundsHandle]MapBounds)
+	for handle, a := range l.areas {
+		stats.Bounds[handle] = a.bounds
+	}
+	stats.SubscribedIDs = make([]string, 0, len(l.watchIds))
+	for id := range l.watchIds {
+		stats.SubscribedIDs = append(stats.SubscribedIDs, id)
+	}
+	sort.Strings(stats.SubscribedIDs)
+	stats.FollowedID = l.followID
+	stats.Filter = l.describeFilter()
+	stats.Predicted = l.predict
+	stats.Err = l.err
+	return stats
+}
+
+func (s *Server) register(l *Listener) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.listeners[l] = l
+}
+
+func (s *Server) unregister(l *Listener) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.listeners, l)
+}
+
+// Listeners returns all the active listeners ordered by ID
+func (s *Server) Listeners() []*Listener {
+	s.lock.RLock()
+	listeners := make([]*Listener, 0, len(s.listeners))
+	for l := range s.listeners {
+		listeners = append(listeners, l)
+	}
+	s.lock.RUnlock()
+
+	sort.Slice(listeners, func(i, j int) bool {
+		return listeners[i].seq < listeners[j].seq
+	})
+	return listeners
+}
@@ -0,0 +1,141 @@
+package spatial
+
+import (
+	"time"
+
+	"github.com/dhconnelly/rtreego"
+)
+
+// TypedServer is a type-safe view of Server for applications indexing
+// objects of a single Go type. Objects of other types possibly present
+// in the underlying Server are skipped by its searches
+type TypedServer[T Indexable] struct {
+	srv *Server
+}
+
+// TypedListener is a Listener sending objects of type T only
+type TypedListener[T Indexable] struct {
+	*Listener
+	ch chan []T
+}
+
+// NewTyped creates and initializes a new TypedServer backed by an R-tree
+func NewTyped[T Indexable](minBranch int, maxBranch int) *TypedServer[T] {
+	return Typed[T](New(minBranch, maxBranch))
+}
+
+// Typed wraps an existing Server into TypedServer
+func Typed[T Indexable](srv *Server) *TypedServer[T] {
+	return &TypedServer[T]{srv: srv}
+}
+
+// RefOf returns the object's Ref converted to R
+func RefOf[R any](obj Indexable) (R, bool) {
+	ref, ok := obj.Ref().(R)
+	return ref, ok
+}
+
+// filterType is a filter refusing objects which are not T
+func filterType[T Indexable](results []rtreego.Spatial, obj rtreego.Spatial) (bool, bool) {
+	_, ok := obj.(T)
+	return !ok, false
+}
+
+// typedOnly converts objects to T skipping objects of other types,
+// Predicted objects are unwrapped
+func typedOnly[T Indexable](objects []Indexable) []T {
+	results := make([]T, 0, len(objects))
+	for _, obj := range objects {
+		typed, ok := obj.(T)
+		if p, predicted := obj.(*Predicted); !ok && predicted {
+			typed, ok = p.Original().(T)
+		}
+		if ok {
+			results = append(results, typed)
+		}
+	}
+	return results
+}
+
+// Server returns the underlying untyped Server
+func (ts *TypedServer[T]) Server() *Server {
+	return ts.srv
+}
+
+// Add adds a new object or modifies the existing one, see Server.Add
+func (ts *TypedServer[T]) Add(obj T) {
+	ts.srv.Add(obj)
+}
+
+// Remove removes a given object, see Server.Remove
+func (ts *TypedServer[T]) Remove(obj T) {
+	ts.srv.Remove(obj)
+}
+
+// BulkLoad replaces all the objects with objs, see Server.BulkLoad
+func (ts *TypedServer[T]) BulkLoad(objs []T) {
+	indexables := make([]Indexable, len(objs))
+	for i, obj := range objs {
+		indexables[i] = obj
+	}
+	ts.srv.BulkLoad(indexables)
+}
+
+// Get returns an object by its id, false is returned if there's
+// no such object or it's not T
+func (ts *TypedServer[T]) Get(id string) (T, bool) {
+	var typed T
+	obj, found := ts.srv.Get(id)
+	if found {
+		typed, found = obj.(T)
+	}
+	return typed, found
+}
+
+// Search syncronously searches for objects intersecting with bb
+func (ts *TypedServer[T]) Search(bb *rtreego.Rect, filters ...rtreego.Filter) []T {
+	filters = append([]rtreego.Filter{filterType[T]}, filters...)
+	results := make([]T, 0)
+	for _, obj := range ts.srv.SearchIntersect(bb, filters...) {
+		results = append(results, obj.(T))
+	}
+	return results
+}
+
+// NearestNeighbors syncronously searches for up to k objects closest to a given point
+func (ts *TypedServer[T]) NearestNeighbors(p rtreego.Point, k int, filters ...rtreego.Filter) []T {
+	filters = append([]rtreego.Filter{filterType[T]}, filters...)
+	return typedOnly[T](ts.srv.NearestNeighbors(p, k, filters...))
+}
+
+// NewListener creates and returns a new typed listener, see Server.NewListener.
+// Objects which are not T are not sent. With prediction on, moving objects
+// are found by their predicted positions but sent as T unwrapped from Predicted
+func (ts *TypedServer[T]) NewListener(chSize int, interval time.Duration, opts ...ListenerOption) *TypedListener[T] {
+	ch := make(chan []T, chSize)
+	// objects are converted by the listener's delivery, so typed
+	// listeners need no goroutines of their own
+	sink := func(l *Listener) {
+		l.sink = func(l *Listener, objects []Indexable) error {
+			typed := typedOnly[T](objects)
+			return sendTo(l, ch, typed, len(typed))
+		}
+		l.closeSink = func() {
+			close(ch)
+		}
+	}
+	return &TypedListener[T]{
+		Listener: ts.srv.NewListener(0, interval, append(opts, sink)...),
+		ch:       ch,
+	}
+}
+
+// Updates returns the typed update channel
+func (tl *TypedListener[T]) Updates() <-chan []T {
+	return tl.ch
+}
+
+// Snapshot synchronously returns the objects currently seen by the listener
+func (tl *TypedListener[T]) Snapshot() []T {
+	return typedOnly[T](tl.Listener.Snapshot())
+}
@@ -0,0 +1,183 @@
+package spatial
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/dhconnelly/rtreego"
+)
+
+// Validation errors, all of them match ErrInvalidBounds with errors.Is
+var (
+	ErrInvalidBounds       = errors.New("invalid bounds")
+	ErrNaNCoordinate       = fmt.Errorf("%w: coordinate is NaN or infinite", ErrInvalidBounds)
+	ErrInvertedBounds      = fmt.Errorf("%w: size is not positive", ErrInvalidBounds)
+	ErrLatitudeOutOfRange  = fmt.Errorf("%w: latitude is out of [-90, 90]", ErrInvalidBounds)
+	ErrLongitudeOutOfRange = fmt.Errorf("%w: longitude is out of [-180, 180]", ErrInvalidBounds)
+
+	// ErrStaleObject is returned by Put for Versioned objects not newer than the indexed ones
+	ErrStaleObject = errors.New("object is not newer than the indexed one")
+)
+
+func finite(values ...float64) bool {
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func checkLatitude(lat float64) error {
+	if lat < -90 || lat > 90 {
+		return ErrLatitudeOutOfRange
+	}
+	return nil
+}
+
+func checkLongitude(lng float64) error {
+	if lng < -180 || lng > 180 {
+		return ErrLongitudeOutOfRange
+	}
+	return nil
+}
+
+// normalizeLongitude brings longitudes outside of [-180, 180] into the range
+func normalizeLongitude(lng float64) float64 {
+	if checkLongitude(lng) == nil {
+		return lng
+	}
+	return wrapLongitude(lng)
+}
+
+// checkSize checks if bounds sizes are positive and not wider than the world,
+// lngSize of bounds crossing the antimeridian counts the part beyond 180
+func checkSize(latSize float64, lngSize float64) error {
+	if latSize <= 0 || lngSize <= 0 {
+		return ErrInvertedBounds
+	}
+	if lngSize > 360 {
+		return ErrLongitudeOutOfRange
+	}
+	return nil
+}
+
+// ValidateRect checks if a rect is a valid object bounds: dimension 0 is
+// latitude and dimension 1 is longitude, both within the world limits.
+// Bounds may cross the antimeridian going beyond 180 but can't be
+// wider than the world
+func ValidateRect(r *rtreego.Rect) error {
+	if r == nil {
+		return ErrInvalidBounds
+	}
+	lat, lng := r.PointCoord(0), r.PointCoord(1)
+	latSize, lngSize := r.LengthsCoord(0), r.LengthsCoord(1)
+	if !finite(lat, lng, latSize, lngSize) {
+		return ErrNaNCoordinate
+	}
+	if err := checkSize(latSize, lngSize); err != nil {
+		return err
+	}
+	if err := checkLatitude(lat); err != nil {
+		return err
+	}
+	if err := checkLatitude(lat + latSize); err != nil {
+		return err
+	}
+	return checkLongitude(lng)
+}
+
+// NewMapBounds creates MapBounds normalizing longitudes outside of [-180, 180].
+// South-west longitude greater than north-east one makes bounds crossing
+// the antimeridian, latitudes can't be inverted
+func NewMapBounds(southWestLat float64, southWestLng float64, northEastLat float64, northEastLng float64) (MapBounds, error) {
+	mb := MapBounds{
+		SouthWestLat: southWestLat,
+		SouthWestLng: southWestLng,
+		NorthEastLat: northEastLat,
+		NorthEastLng: northEastLng,
+	}
+	if finite(southWestLng, northEastLng) {
+		mb.SouthWestLng = normalizeLongitude(southWestLng)
+		mb.NorthEastLng = normalizeLongitude(northEastLng)
+	}
+	return mb, mb.Validate()
+}
+
+// Validate checks if MapBounds are valid
+func (mb *MapBounds) Validate() error {
+	if !finite(mb.SouthWestLat, mb.SouthWestLng, mb.NorthEastLat, mb.NorthEastLng) {
+		return ErrNaNCoordinate
+	}
+	for _, lat := range []float64{mb.SouthWestLat, mb.NorthEastLat} {
+		if err := checkLatitude(lat); err != nil {
+			return err
+		}
+	}
+	for _, lng := range []float64{mb.SouthWestLng, mb.NorthEastLng} {
+		if err := checkLongitude(lng); err != nil {
+			return err
+		}
+	}
+	lngSize := mb.NorthEastLng - mb.SouthWestLng
+	if lngSize < 0 {
+		// crossing the antimeridian
+		lngSize += 360
+	}
+	return checkSize(mb.NorthEastLat-mb.SouthWestLat, lngSize)
+}
+
+// NormalizeRect returns a rect with the longitude brought into [-180, 180],
+// rects within the range and invalid ones are returned as is. NewObject
+// normalizes bounds with it, custom Indexables should do the same
+func NormalizeRect(r *rtreego.Rect) *rtreego.Rect {
+	if r == nil {
+		return r
+	}
+	lng := r.PointCoord(1)
+	if !finite(lng) || checkLongitude(lng) == nil {
+		return r
+	}
+	normalized, err := rtreego.NewRect(
+		rtreego.Point{r.PointCoord(0), wrapLongitude(lng)},
+		[]float64{r.LengthsCoord(0), r.LengthsCoord(1)},
+	)
+	if err != nil {
+		return r
+	}
+	return normalized
+}
+
+// prepare validates an object before writing it. Longitudes are checked
+// normalized as objects beyond [-180, 180] are indexed wrapped
+func prepare(obj Indexable) error {
+	if err := ValidateRect(NormalizeRect(obj.Bounds())); err != nil {
+		return fmt.Errorf("object %s: %w", obj.ID(), err)
+	}
+	return nil
+}
+
+// Put adds a new object or modifies the existing one like Add does, but returns
+// an error if the object bounds are invalid or the object is stale. Objects are
+// never modified: bounds starting beyond [-180, 180] longitudes are indexed
+// and matched wrapped into the range, NewObject and NormalizeRect bring them
+// into the range in place
+func (s *Server) Put(obj Indexable) error {
+	if err := prepare(obj); err != nil {
+		atomic.AddUint64(&s.invalidWrites, 1)
+		return err
+	}
+
+	if !s.addIf(obj, time.Now(), nil) {
+		return ErrStaleObject
+	}
+	return nil
+}
+
+// InvalidWrites returns the number of writes rejected for invalid bounds
+func (s *Server) InvalidWrites() uint64 {
+	return atomic.LoadUint64(&s.invalidWrites)
+}
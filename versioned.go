@@ -0,0 +1,88 @@
+package spatial
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Versioned is implemented by objects carrying a version of their own, e.g.
+// a sequence number or a timestamp of a position report. Server.Add ignores
+// objects with versions not greater than the version of the object already
+// indexed, so out-of-order reports can't overwrite newer ones and duplicate
+// reports don't wake listeners up
+type Versioned interface {
+	Version() uint64
+}
+
+// isStale checks if obj is not newer than curr, objects
+// are stale only if both of them are Versioned
+func isStale(curr Indexable, obj Indexable) bool {
+	cv, ok := curr.(Versioned)
+	if !ok {
+		return false
+	}
+	ov, ok := obj.(Versioned)
+	return ok && ov.Version() <= cv.Version()
+}
+
+// StaleWrites returns the number of writes of Versioned objects
+// ignored as being not newer than the indexed ones
+func (s *Server) StaleWrites() uint64 {
+	return atomic.LoadUint64(&s.staleWrites)
+}
+
+// versionsOf returns server versions of objects which are still current
+func (s *Server) versionsOf(objects []Indexable) map[string]uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	versions := make(map[string]uint64, len(objects))
+	for _, obj := range objects {
+		if p, ok := obj.(*Predicted); ok {
+			obj = p.Original()
+		}
+		if curr, found := s.idIdx[obj.ID()]; found && sameIndexable(curr, obj) {
+			versions[obj.ID()] = s.versions[obj.ID()]
+		}
+	}
+	return versions
+}
+
+// VersionedUpdate is an update of VersionedListener
+type VersionedUpdate struct {
+	Objects []Indexable
+	// Versions holds server versions of the objects at the time of delivery,
+	// objects replaced while the update was being collected have none as
+	// another update with them follows
+	Versions map[string]uint64
+}
+
+// VersionedListener is a Listener sending server versions along with objects,
+// so clients can order updates the same way ListenerEvent allows to
+type VersionedListener struct {
+	*Listener
+	ch chan VersionedUpdate
+}
+
+// NewVersionedListener creates and returns a new listener sending objects
+// with their versions, see NewListener
+func (s *Server) NewVersionedListener(chSize int, interval time.Duration, opts ...ListenerOption) *VersionedListener {
+	ch := make(chan VersionedUpdate, chSize)
+	sink := func(l *Listener) {
+		l.sink = func(l *Listener, objects []Indexable) error {
+			update := VersionedUpdate{Objects: objects, Versions: s.versionsOf(objects)}
+			return sendTo(l, ch, update, len(objects))
+		}
+		l.closeSink = func() {
+			close(ch)
+		}
+	}
+	return &VersionedListener{
+		Listener: s.NewListener(0, interval, append(opts, sink)...),
+		ch:       ch,
+	}
+}
+
+// Updates returns the versioned update channel
+func (vl *VersionedListener) Updates() <-chan VersionedUpdate {
+	return vl.ch
+}